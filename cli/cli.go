@@ -11,6 +11,7 @@ import (
 
 	"github.com/discuitnet/discuit/cli/migrate"
 	"github.com/discuitnet/discuit/config"
+	"github.com/discuitnet/discuit/core"
 	"github.com/joho/godotenv"
 	"github.com/urfave/cli/v2"
 )
@@ -24,6 +25,9 @@ func Before(c *cli.Context) error {
 	if err != nil {
 		log.Fatal("Error parsing config file: ", err)
 	}
+	if err := core.SetHotnessDefaults(conf.Hotness, conf.NormalizeAllFeedHotness); err != nil {
+		log.Fatal(err)
+	}
 
 	// Connect to MariaDB.
 	db := openDatabase(conf.DBAddr, conf.DBUser, conf.DBPassword, conf.DBName)
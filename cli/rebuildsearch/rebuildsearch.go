@@ -0,0 +1,20 @@
+package rebuildsearch
+
+import (
+	"database/sql"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/urfave/cli/v2"
+)
+
+var Command = &cli.Command{
+	Name:  "rebuild-search-index",
+	Usage: "Rebuild the full-text search indexes",
+	Action: func(ctx *cli.Context) error {
+		db := ctx.Context.Value("db").(*sql.DB)
+		if err := core.RebuildSearchIndex(ctx.Context, db); err != nil {
+			return err
+		}
+		return nil
+	},
+}
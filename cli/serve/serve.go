@@ -20,6 +20,9 @@ import (
 	"github.com/urfave/cli/v2"
 )
 
+// How often the post views queued in Redis are saved to the database.
+const postViewsFlushInterval = time.Second * 30
+
 var Command = &cli.Command{
 	Name:  "serve",
 	Usage: "Start web server",
@@ -77,6 +80,15 @@ func serve(ctx *cli.Context) error {
 			if err := core.PurgePostsFromTempTables(context.TODO(), db); err != nil {
 				log.Printf("Temp posts purging failed: %v\n", err)
 			}
+			if err := core.UpdatePostsRising(context.TODO(), db); err != nil {
+				log.Printf("Updating rising scores failed: %v\n", err)
+			}
+			if err := core.UpdateCommunitiesHotnessBaseline(context.TODO(), db); err != nil {
+				log.Printf("Updating hotness baselines failed: %v\n", err)
+			}
+			if err := core.PurgeOldPostViews(context.TODO(), db); err != nil {
+				log.Printf("Purging old post views failed: %v\n", err)
+			}
 			if n, err := core.RemoveTempImages(context.TODO(), db); err != nil {
 				log.Printf("Failed to remove temp images: %v\n", err)
 			} else {
@@ -86,6 +98,16 @@ func serve(ctx *cli.Context) error {
 		}
 	}()
 
+	go func() {
+		// Save the post views queued in Redis.
+		for {
+			time.Sleep(postViewsFlushInterval)
+			if _, err := site.FlushPostViews(context.TODO()); err != nil {
+				log.Printf("Flushing post views failed: %v\n", err)
+			}
+		}
+	}()
+
 	if !config.AddressValid(conf.Addr) {
 		log.Fatal("Address needs to be a valid address of the form 'host:port' (host can be empty)")
 	}
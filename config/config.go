@@ -30,6 +30,13 @@ type Config struct {
 
 	RedisAddress string `yaml:"redisAddress"`
 
+	// The pub/sub broker used by realtime features (like chat). Either "redis"
+	// or "memory". With "memory", the rest of the state of chat (presence, rate
+	// limits) is kept in memory as well, which works only if there's a single
+	// instance of the server running. Redis is still needed for sessions,
+	// caching, and the rest of the rate limits.
+	PubSubBroker string `yaml:"pubSubBroker"`
+
 	HMACSecret string `yaml:"hmacSecret"`
 
 	CSRFOff bool `yaml:"csrfOff"`
@@ -40,6 +47,18 @@ type Config struct {
 	PaginationLimitMax int           `yaml:"paginationLimitMax"`
 	DefaultFeedSort    core.FeedSort `yaml:"defaultFeedSort"`
 
+	// The number of seconds for which the feeds of logged out users are
+	// cached in Redis. If it's zero, the feeds are not cached.
+	FeedCacheTTL int `yaml:"feedCacheTTL"`
+
+	// The site-wide default hotness config, which communities may override.
+	Hotness core.HotnessConfig `yaml:"hotness"`
+
+	// If true, the hotness of posts in the hot "all" feed is normalized
+	// across communities, so that slow communities aren't buried by busy
+	// ones.
+	NormalizeAllFeedHotness bool `yaml:"normalizeAllFeedHotness"`
+
 	// Captcha verification is skipped if empty.
 	CaptchaSecret string `yaml:"captchaSecret"`
 
@@ -61,6 +80,10 @@ type Config struct {
 
 	// The location where images are saved on disk.
 	ImagesFolderPath string `yaml:"imagesFolderPath"`
+
+	// Origins (of the form "https://example.com") that are allowed to open a
+	// chat websocket connection, in addition to the site's own origin.
+	ChatAllowedOrigins []string `yaml:"chatAllowedOrigins"`
 }
 
 // Parse parses the yaml file at path and returns a Config.
@@ -71,9 +94,12 @@ func Parse(path string) (*Config, error) {
 		DBUser:             "discuit",
 		SessionCookieName:  "SID",
 		RedisAddress:       ":6379",
+		PubSubBroker:       "redis",
 		PaginationLimit:    10,
 		PaginationLimitMax: 50,
 		DefaultFeedSort:    core.FeedSortHot,
+		Hotness:            core.DefaultHotnessConfig(),
+		FeedCacheTTL:       30,
 		MaxImageSize:       25 * (1 << 20),
 
 		// Required fields:
@@ -99,6 +125,7 @@ func Parse(path string) (*Config, error) {
 		"DISCUIT_SESSION_COOKIE_NAME": &c.SessionCookieName,
 
 		"DISCUIT_REDIS_ADDRESS": &c.RedisAddress,
+		"DISCUIT_PUBSUB_BROKER": &c.PubSubBroker,
 
 		"DISCUIT_HMAC_SECRET": &c.HMACSecret,
 
@@ -110,6 +137,9 @@ func Parse(path string) (*Config, error) {
 		"DISCUIT_PAGINATION_LIMIT_MAX": &c.PaginationLimitMax,
 		"DISCUIT_DEFAULT_FEED_SORT":    &c.DefaultFeedSort,
 
+		"DISCUIT_NORMALIZE_ALL_FEED_HOTNESS": &c.NormalizeAllFeedHotness,
+		"DISCUIT_FEED_CACHE_TTL":             &c.FeedCacheTTL,
+
 		// Captcha verification is skipped if empty.
 		"DISCUIT_CAPTCHA_SECRET": &c.CaptchaSecret,
 		"DISCUIT_CERT_FILE":      &c.CertFile,
@@ -130,6 +160,9 @@ func Parse(path string) (*Config, error) {
 
 		// The location where images are saved on disk.
 		"DISCUIT_IMAGES_FOLDER_PATH": &c.ImagesFolderPath,
+
+		// A comma separated list of origins.
+		"DISCUIT_CHAT_ALLOWED_ORIGINS": &c.ChatAllowedOrigins,
 	}
 
 	// Attempt to unmarshal the YAML file if it exists
@@ -160,6 +193,13 @@ func Parse(path string) (*Config, error) {
 				if b, err := strconv.ParseBool(value); err == nil {
 					*v = b
 				}
+			case *[]string:
+				*v = nil
+				for _, item := range strings.Split(value, ",") {
+					if item = strings.TrimSpace(item); item != "" {
+						*v = append(*v, item)
+					}
+				}
 			case *core.FeedSort:
 				if err := v.UnmarshalText([]byte(value)); err != nil {
 					return nil, err
@@ -177,6 +217,9 @@ func Parse(path string) (*Config, error) {
 	if c.MaxForumsPerUser == -1 {
 		return nil, errors.New("MaxForumsPerUser cannot be (-1)")
 	}
+	if c.PubSubBroker != "redis" && c.PubSubBroker != "memory" {
+		return nil, errors.New("PubSubBroker must be either redis or memory")
+	}
 
 	return c, nil
 }
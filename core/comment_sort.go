@@ -0,0 +1,157 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// CommentSort represents how the comments of a post are to be sorted. Comments
+// are sorted within each group of siblings, so the tree structure of the
+// comments is preserved.
+type CommentSort int
+
+const (
+	CommentSortTop           = CommentSort(iota) // Most upvoted first.
+	CommentSortNew                               // Newest first.
+	CommentSortOld                               // Oldest first.
+	CommentSortControversial                     // See PostControversy.
+	CommentSortBest                              // See PostBestScore.
+)
+
+// Valid reports whether s is a valid CommentSort.
+func (s CommentSort) Valid() bool {
+	_, err := s.MarshalText()
+	return err == nil
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (s CommentSort) MarshalText() ([]byte, error) {
+	switch s {
+	case CommentSortTop:
+		return []byte("top"), nil
+	case CommentSortNew:
+		return []byte("new"), nil
+	case CommentSortOld:
+		return []byte("old"), nil
+	case CommentSortControversial:
+		return []byte("controversial"), nil
+	case CommentSortBest:
+		return []byte("best"), nil
+	}
+	return nil, fmt.Errorf("cannot marshal unsupported CommentSort (%v)", int(s))
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (s *CommentSort) UnmarshalText(text []byte) error {
+	t := string(text)
+	switch t {
+	case "top":
+		*s = CommentSortTop
+	case "new":
+		*s = CommentSortNew
+	case "old":
+		*s = CommentSortOld
+	case "controversial":
+		*s = CommentSortControversial
+	case "best":
+		*s = CommentSortBest
+	default:
+		return fmt.Errorf("cannot unmarshal unsupported CommentSort: %v", t)
+	}
+	return nil
+}
+
+// scoreSQL returns an SQL expression that evaluates to the score of a comment
+// by which comments are sorted (in descending order). For CommentSortNew and
+// CommentSortOld, comments are sorted by their ids alone and the score is
+// always zero.
+//
+// The expressions mirror PostControversy and PostBestScore.
+func (s CommentSort) scoreSQL() string {
+	switch s {
+	case CommentSortTop:
+		return "comments.upvotes"
+	case CommentSortControversial:
+		return "IF(comments.upvotes > 0 AND comments.downvotes > 0, " +
+			"ROUND(POW(comments.upvotes + comments.downvotes, " +
+			"LEAST(comments.upvotes, comments.downvotes) / GREATEST(comments.upvotes, comments.downvotes)) * 10000000), 0)"
+	case CommentSortBest:
+		z := strconv.FormatFloat(bestZScore, 'f', -1, 64)
+		n := "(comments.upvotes + comments.downvotes)"
+		p := "(comments.upvotes / " + n + ")"
+		return "IF(" + n + " > 0, ROUND((" + p + " + " + z + "*" + z + "/(2*" + n + ") - " +
+			z + "*SQRT((" + p + "*(1-" + p + ") + " + z + "*" + z + "/(4*" + n + "))/" + n + ")) / (1 + " +
+			z + "*" + z + "/" + n + ") * 10000000), 0)"
+	}
+	return "0"
+}
+
+// score is the Go counterpart of scoreSQL.
+func (s CommentSort) score(c *Comment) int {
+	switch s {
+	case CommentSortTop:
+		return c.Upvotes
+	case CommentSortControversial:
+		return PostControversy(c.Upvotes, c.Downvotes)
+	case CommentSortBest:
+		return PostBestScore(c.Upvotes, c.Downvotes)
+	}
+	return 0
+}
+
+// less reports whether comment a comes before comment b.
+func (s CommentSort) less(a, b *Comment) bool {
+	if s == CommentSortOld {
+		return bytes.Compare(a.ID.Bytes(), b.ID.Bytes()) < 0
+	}
+	if sa, sb := s.score(a), s.score(b); sa != sb {
+		return sa > sb
+	}
+	return bytes.Compare(a.ID.Bytes(), b.ID.Bytes()) > 0
+}
+
+// sortCommentsTree sorts comments so that each comment is followed by its
+// descendants (depth-first), with each group of siblings sorted by s. Comments
+// whose parent is not in comments are treated as roots.
+func sortCommentsTree(comments []*Comment, s CommentSort) []*Comment {
+	present := make(map[uid.ID]bool, len(comments))
+	for _, c := range comments {
+		present[c.ID] = true
+	}
+
+	var roots []*Comment
+	children := make(map[uid.ID][]*Comment)
+	for _, c := range comments {
+		if c.ParentID.Valid && present[c.ParentID.ID] {
+			children[c.ParentID.ID] = append(children[c.ParentID.ID], c)
+		} else {
+			roots = append(roots, c)
+		}
+	}
+
+	sorted := make([]*Comment, 0, len(comments))
+	var walk func([]*Comment)
+	walk = func(siblings []*Comment) {
+		sort.SliceStable(siblings, func(i, j int) bool {
+			return s.less(siblings[i], siblings[j])
+		})
+		for _, c := range siblings {
+			sorted = append(sorted, c)
+			walk(children[c.ID])
+		}
+	}
+	walk(roots)
+	return sorted
+}
+
+// DefaultCommentSort returns the default comment sort of the community of p.
+func (p *Post) DefaultCommentSort(ctx context.Context) (CommentSort, error) {
+	var s CommentSort
+	err := p.db.QueryRowContext(ctx, "SELECT default_comment_sort FROM communities WHERE id = ?", p.CommunityID).Scan(&s)
+	return s, err
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+func TestSortCommentsTree(t *testing.T) {
+	ids := make([]uid.ID, 5)
+	for i := range ids {
+		ids[i] = uid.From(uint64(i+1), 0)
+	}
+	parent := func(i int) uid.NullID { return uid.NullID{ID: ids[i], Valid: true} }
+	comments := []*Comment{
+		{ID: ids[0], Upvotes: 1},
+		{ID: ids[1], Upvotes: 5},
+		{ID: ids[2], ParentID: parent(0), Upvotes: 2},
+		{ID: ids[3], ParentID: parent(0), Upvotes: 3},
+		{ID: ids[4], ParentID: parent(1), Upvotes: 0},
+	}
+
+	tests := []struct {
+		sort CommentSort
+		want []int // Indices of ids.
+	}{
+		{CommentSortTop, []int{1, 4, 0, 3, 2}},
+		{CommentSortNew, []int{1, 4, 0, 3, 2}},
+		{CommentSortOld, []int{0, 2, 3, 1, 4}},
+	}
+	for _, test := range tests {
+		input := append([]*Comment(nil), comments...)
+		got := sortCommentsTree(input, test.sort)
+		if len(got) != len(test.want) {
+			t.Fatalf("sort %v: got %d comments, want %d", test.sort, len(got), len(test.want))
+		}
+		for i, c := range got {
+			if c.ID != ids[test.want[i]] {
+				t.Errorf("sort %v: comment at %d is %v, want %v", test.sort, i, c.ID, ids[test.want[i]])
+			}
+		}
+	}
+}
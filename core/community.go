@@ -3,6 +3,7 @@ package core
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -37,6 +38,14 @@ type Community struct {
 	DeletedAt     msql.NullTime   `json:"deletedAt"`
 	DeletedBy     uid.NullID      `json:"-"`
 
+	DefaultCommentSort CommentSort `json:"defaultCommentSort"`
+
+	// If true, posts submitted to the community must have a flair.
+	FlairRequired bool `json:"flairRequired"`
+
+	// HotnessConfig is nil if the community uses the site-wide default.
+	HotnessConfig *HotnessConfig `json:"hotnessConfig"`
+
 	// IsDefault is nil until Default is called.
 	IsDefault *bool `json:"isDefault,omitempty"`
 
@@ -46,6 +55,7 @@ type Community struct {
 
 	Mods           []*User                  `json:"mods"`
 	Rules          []*CommunityRule         `json:"rules"`
+	Flairs         []*CommunityFlair        `json:"flairs,omitempty"` // Nil until FetchFlairs is called.
 	ReportsDetails *CommunityReportsDetails `json:"ReportsDetails"`
 }
 
@@ -60,6 +70,9 @@ func buildSelectCommunityQuery(where string) string {
 		"communities.no_members",
 		"communities.created_at",
 		"communities.deleted_at",
+		"communities.default_comment_sort",
+		"communities.flair_required",
+		"communities.hotness_config",
 	}
 	cols = append(cols, images.ImageColumns("pro_pic")...)
 	cols = append(cols, images.ImageColumns("banner")...)
@@ -157,6 +170,7 @@ func scanCommunities(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *ui
 	var comms []*Community
 	for rows.Next() {
 		c := &Community{db: db}
+		var hotnessConfig []byte
 		dests := []any{
 			&c.ID,
 			&c.AuthorID,
@@ -167,6 +181,9 @@ func scanCommunities(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *ui
 			&c.NumMembers,
 			&c.CreatedAt,
 			&c.DeletedAt,
+			&c.DefaultCommentSort,
+			&c.FlairRequired,
+			&hotnessConfig,
 		}
 
 		proPic, bannerImage := &images.Image{}, &images.Image{}
@@ -176,6 +193,12 @@ func scanCommunities(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *ui
 		if err := rows.Scan(dests...); err != nil {
 			return nil, err
 		}
+		if hotnessConfig != nil {
+			c.HotnessConfig = &HotnessConfig{}
+			if err := json.Unmarshal(hotnessConfig, c.HotnessConfig); err != nil {
+				return nil, err
+			}
+		}
 
 		if proPic.ID != nil {
 			proPic.PostScan()
@@ -420,7 +443,10 @@ func (c *Community) Update(ctx context.Context, mod uid.ID) error {
 	}
 
 	c.About.String = utils.TruncateUnicodeString(c.About.String, maxCommunityAboutLength)
-	_, err := c.db.ExecContext(ctx, "UPDATE communities SET nsfw = ?, about = ? WHERE id = ?", c.NSFW, c.About, c.ID)
+	if !c.DefaultCommentSort.Valid() {
+		return httperr.NewBadRequest("invalid_comment_sort", "Invalid default comment sort.")
+	}
+	_, err := c.db.ExecContext(ctx, "UPDATE communities SET nsfw = ?, about = ?, default_comment_sort = ? WHERE id = ?", c.NSFW, c.About, c.DefaultCommentSort, c.ID)
 	return err
 }
 
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/images"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// maxMessageImages is the maximum number of images a message can have.
+const maxMessageImages = 4
+
+func setMessageImageCopies(image *images.Image) {
+	image.AppendCopy("tiny", 120, 120, images.ImageFitCover, "")
+	image.AppendCopy("small", 320, 320, images.ImageFitCover, "")
+	image.AppendCopy("medium", 720, 1440, images.ImageFitContain, "")
+	image.AppendCopy("large", 1440, 2880, images.ImageFitContain, "")
+}
+
+// SaveMessageImage saves an image that's to be attached to a message by sender.
+// Until it's attached to a message, the image is a temp image, and it's deleted
+// by RemoveTempImages if it's not attached to one in time.
+func SaveMessageImage(ctx context.Context, db *sql.DB, sender uid.ID, image []byte) (*images.Image, error) {
+	record, err := images.SaveImage(ctx, db, "disk", image, &images.ImageOptions{
+		Width:  2880,
+		Height: 2880,
+		Format: images.ImageFormatJPEG,
+		Fit:    images.ImageFitContain,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save message image (sender: %v): %w", sender, err)
+	}
+
+	if _, err := db.ExecContext(ctx, "INSERT INTO temp_images_2 (user_id, image_id, purpose) values (?, ?, ?)", sender, record.ID, tempImageMessage); err != nil {
+		if err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+			return images.DeleteImageTx(ctx, tx, db, record.ID)
+		}); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to insert row into temp_images (sender: %v, image: %v): %w", sender, record.ID, err)
+	}
+
+	img := record.Image()
+	setMessageImageCopies(img)
+	return img, nil
+}
+
+// checkMessageImages returns an error if any of the images was not uploaded by
+// sender as a temp image (with SaveMessageImage).
+func checkMessageImages(ctx context.Context, db *sql.DB, sender uid.ID, imageIDs []uid.ID) error {
+	if len(imageIDs) == 0 {
+		return nil
+	}
+	if len(imageIDs) > maxMessageImages {
+		return httperr.NewBadRequest("msg/too-many-images", fmt.Sprintf("A message can have at most %d images.", maxMessageImages))
+	}
+
+	args := []any{sender, tempImageMessage}
+	for _, id := range imageIDs {
+		args = append(args, id)
+	}
+	var count int
+	query := "SELECT COUNT(DISTINCT image_id) FROM temp_images_2 WHERE user_id = ? AND purpose = ? AND image_id IN " + msql.InClauseQuestionMarks(len(imageIDs))
+	if err := db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return err
+	}
+	if count != len(imageIDs) {
+		return httperr.NewBadRequest("msg/invalid-images", "Invalid message images.")
+	}
+	return nil
+}
+
+// attachMessageImagesTx attaches the temp images imageIDs to the message msg,
+// in that order.
+func attachMessageImagesTx(ctx context.Context, tx *sql.Tx, msg uid.ID, imageIDs []uid.ID) error {
+	for i, id := range imageIDs {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO msg_images (msg_id, image_id, position) VALUES (?, ?, ?)", msg, id, i); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM temp_images_2 WHERE image_id = ? AND purpose = ?", id, tempImageMessage); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fillMessageImages populates the Images field of msgs.
+func fillMessageImages(ctx context.Context, db *sql.DB, msgs []*Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	cols := images.ImageRecordColumns()
+	cols = append(cols, "msg_images.msg_id")
+	query := msql.BuildSelectQuery("msg_images", cols, []string{
+		"INNER JOIN images ON images.id = msg_images.image_id",
+	}, "WHERE msg_id IN "+msql.InClauseQuestionMarks(len(msgs))+" ORDER BY msg_images.position")
+
+	args := make([]any, len(msgs))
+	for i := range msgs {
+		args[i] = msgs[i].ID
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		record, msgID := &images.ImageRecord{}, uid.ID{}
+		dest := record.ScanDestinations()
+		dest = append(dest, &msgID)
+		if err = rows.Scan(dest...); err != nil {
+			return err
+		}
+
+		for _, msg := range msgs {
+			if msg.ID == msgID {
+				img := record.Image()
+				setMessageImageCopies(img)
+				msg.Images = append(msg.Images, img)
+				break
+			}
+		}
+	}
+
+	return rows.Err()
+}
+
+// deleteMessagesImagesTx deletes all the images attached to the messages that
+// match the where clause (on the msg table).
+func deleteMessagesImagesTx(ctx context.Context, tx *sql.Tx, db *sql.DB, where string, args ...any) error {
+	rows, err := tx.QueryContext(ctx, "SELECT image_id FROM msg_images WHERE msg_id IN (SELECT id FROM msg "+where+")", args...)
+	if err != nil {
+		return err
+	}
+	var imageIDs []uid.ID
+	for rows.Next() {
+		var id uid.ID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		imageIDs = append(imageIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM msg_images WHERE msg_id IN (SELECT id FROM msg "+where+")", args...); err != nil {
+		return err
+	}
+	for _, id := range imageIDs {
+		if err := images.DeleteImageTx(ctx, tx, db, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,439 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/discuitnet/discuit/internal/utils"
+)
+
+const (
+	maxConvTitleLength     = 100 // in runes.
+	maxConvGroupMembersNum = 50
+)
+
+var (
+	errNotConvParticipant = httperr.NewForbidden("conv/not-participant", "Not a participant of this conversation.")
+	errConvNotGroup       = httperr.NewBadRequest("conv/not-group", "Not a group conversation.")
+	errConvNotAdmin       = httperr.NewForbidden("conv/not-admin", "Not an admin of this conversation.")
+)
+
+// ConvRole is the role of a participant of a conv.
+type ConvRole string
+
+const (
+	ConvRoleOwner  = ConvRole("owner")
+	ConvRoleAdmin  = ConvRole("admin")
+	ConvRoleMember = ConvRole("member")
+)
+
+func (r ConvRole) Valid() bool {
+	return slices.Contains([]ConvRole{ConvRoleOwner, ConvRoleAdmin, ConvRoleMember}, r)
+}
+
+// canManage reports whether a participant with the role r can add and remove
+// participants and change the title of a group conv.
+func (r ConvRole) canManage() bool {
+	return r == ConvRoleOwner || r == ConvRoleAdmin
+}
+
+// ConvParticipant is a member of a conv.
+type ConvParticipant struct {
+	ConvID   uid.ID   `json:"-"`
+	UserID   uid.ID   `json:"userId"`
+	Username string   `json:"username"` // Not in the table
+	Role     ConvRole `json:"role"`
+
+	// Pending is true if the user was added to the group conv by someone they
+	// haven't interacted with and they have yet to accept the invitation (see
+	// Convs.AcceptRequest).
+	Pending bool `json:"pending"`
+
+	JoinedAt        time.Time     `json:"joinedAt"`
+	LastSeenAt      msql.NullTime `json:"lastSeenAt"`
+	LastSeenMessage uid.NullID    `json:"lastSeenMessage"`
+
+	// Chat presence of the user. Not in the table; these are only set when
+	// presence data is available.
+	Online       bool       `json:"online"`
+	LastActiveAt *time.Time `json:"lastActiveAt,omitempty"`
+}
+
+// fillConvParticipants sets the Participants field of each of convs.
+func fillConvParticipants(ctx context.Context, db *sql.DB, convs []*Convs) error {
+	if len(convs) == 0 {
+		return nil
+	}
+
+	args := make([]any, len(convs))
+	for i, conv := range convs {
+		args[i] = conv.ID
+		conv.Participants = []*ConvParticipant{}
+	}
+
+	query := msql.BuildSelectQuery("conv_participants", []string{
+		"conv_participants.conv_id",
+		"conv_participants.user_id",
+		"users.username",
+		"conv_participants.role",
+		"conv_participants.pending",
+		"conv_participants.joined_at",
+		"conv_participants.last_seen_at",
+		"conv_participants.last_seen_msg",
+	}, []string{
+		"INNER JOIN users ON conv_participants.user_id = users.id",
+	}, "WHERE conv_participants.conv_id IN "+msql.InClauseQuestionMarks(len(args))+" ORDER BY conv_participants.joined_at")
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p := &ConvParticipant{}
+		if err := rows.Scan(&p.ConvID, &p.UserID, &p.Username, &p.Role, &p.Pending, &p.JoinedAt, &p.LastSeenAt, &p.LastSeenMessage); err != nil {
+			return err
+		}
+		for _, conv := range convs {
+			if conv.ID == p.ConvID {
+				conv.Participants = append(conv.Participants, p)
+				break
+			}
+		}
+	}
+	return rows.Err()
+}
+
+// Participant returns the participant of the conv that is user. It returns nil
+// if user is not a participant of the conv.
+func (c *Convs) Participant(user uid.ID) *ConvParticipant {
+	for _, p := range c.Participants {
+		if p.UserID == user {
+			return p
+		}
+	}
+	return nil
+}
+
+// HasParticipant reports whether user is a participant of the conv.
+func (c *Convs) HasParticipant(user uid.ID) bool {
+	return c.Participant(user) != nil
+}
+
+// ParticipantIDs returns the IDs of all the participants of the conv, except
+// for the user except.
+func (c *Convs) ParticipantIDs(except uid.ID) []uid.ID {
+	var ids []uid.ID
+	for _, p := range c.Participants {
+		if p.UserID != except {
+			ids = append(ids, p.UserID)
+		}
+	}
+	return ids
+}
+
+// MemberIDs is the same as ParticipantIDs, except that pending participants
+// (users invited to the group conv who haven't accepted yet) are skipped. Only
+// members get the messages of the conv.
+func (c *Convs) MemberIDs(except uid.ID) []uid.ID {
+	var ids []uid.ID
+	for _, p := range c.Participants {
+		if p.UserID != except && !p.Pending {
+			ids = append(ids, p.UserID)
+		}
+	}
+	return ids
+}
+
+// UsersShareConv reports whether the users a and b are both participants of
+// at least one conv.
+func UsersShareConv(ctx context.Context, db *sql.DB, a, b uid.ID) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM conv_participants AS p1
+		INNER JOIN conv_participants AS p2 ON p1.conv_id = p2.conv_id
+		WHERE p1.user_id = ? AND p2.user_id = ?`, a, b).Scan(&n)
+	return n > 0, err
+}
+
+// OtherParticipant returns the ID of the participant of a conversation between
+// two users that is not user. It assumes that user is a participant of the
+// conv.
+func (c *Convs) OtherParticipant(user uid.ID) uid.ID {
+	if c.User1ID == user {
+		return c.User2ID.ID
+	}
+	return c.User1ID
+}
+
+func (c *Convs) addParticipantTx(ctx context.Context, tx *sql.Tx, user *User, role ConvRole, pending bool) error {
+	p := &ConvParticipant{
+		ConvID:   c.ID,
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     role,
+		Pending:  pending,
+		JoinedAt: time.Now(),
+	}
+	query, args := msql.BuildInsertQuery("conv_participants", []msql.ColumnValue{
+		{Name: "conv_id", Value: p.ConvID},
+		{Name: "user_id", Value: p.UserID},
+		{Name: "role", Value: p.Role},
+		{Name: "pending", Value: p.Pending},
+		{Name: "joined_at", Value: p.JoinedAt},
+	})
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		if msql.IsErrDuplicateErr(err) {
+			return httperr.NewBadRequest("conv/already-participant", "User is already a participant of this conversation.")
+		}
+		return err
+	}
+	c.Participants = append(c.Participants, p)
+	return nil
+}
+
+func validateConvTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return "", httperr.NewBadRequest("conv/empty-title", "Title cannot be empty.")
+	}
+	return utils.TruncateUnicodeString(title, maxConvTitleLength), nil
+}
+
+// checkCanAddToConv returns an error if the DM privacy setting of user doesn't
+// allow adder to add them to a group conv. If adder is allowed to, but user
+// hasn't interacted with adder, pending is true: user is added as a pending
+// participant, who has to accept the invitation like a message request.
+func checkCanAddToConv(ctx context.Context, db *sql.DB, adder, user *User) (pending bool, err error) {
+	return checkCanMessage(ctx, db, adder, user)
+}
+
+// CreateGroupConv creates a new group conversation with the given title. The
+// user owner is the owner of the conv, and members are its initial
+// participants.
+func CreateGroupConv(ctx context.Context, db *sql.DB, owner *User, title string, members []*User) (*Convs, error) {
+	title, err := validateConvTitle(title)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		unique  []*User
+		pending = make(map[uid.ID]bool)
+	)
+	for _, member := range members {
+		if member.ID == owner.ID || slices.ContainsFunc(unique, func(u *User) bool { return u.ID == member.ID }) {
+			continue
+		}
+		p, err := checkCanAddToConv(ctx, db, owner, member)
+		if err != nil {
+			return nil, err
+		}
+		pending[member.ID] = p
+		unique = append(unique, member)
+	}
+	if len(unique) == 0 {
+		return nil, httperr.NewBadRequest("conv/no-members", "A group conversation needs at least one other member.")
+	}
+	if len(unique)+1 > maxConvGroupMembersNum {
+		return nil, httperr.NewBadRequest("conv/too-many-members", "Too many members.")
+	}
+
+	conv := &Convs{
+		ID:        uid.New(),
+		Title:     msql.NewNullString(title),
+		IsGroup:   true,
+		Status:    ConvStatusAccepted,
+		User1ID:   owner.ID,
+		Username1: owner.Username,
+		StartedAt: time.Now(),
+	}
+	query, args := msql.BuildInsertQuery("convs", []msql.ColumnValue{
+		{Name: "id", Value: conv.ID},
+		{Name: "title", Value: conv.Title},
+		{Name: "is_group", Value: conv.IsGroup},
+		{Name: "user1_id", Value: conv.User1ID},
+		{Name: "started_at", Value: conv.StartedAt},
+		{Name: "num_msgs", Value: conv.NumMessages},
+	})
+	err = msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+		if err := conv.addParticipantTx(ctx, tx, owner, ConvRoleOwner, false); err != nil {
+			return err
+		}
+		for _, member := range unique {
+			if err := conv.addParticipantTx(ctx, tx, member, ConvRoleMember, pending[member.ID]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+// checkManager returns an error if the conv is not a group conv or if the user
+// by is not an owner or admin of the conv.
+func (c *Convs) checkManager(by uid.ID) error {
+	if !c.IsGroup {
+		return errConvNotGroup
+	}
+	p := c.Participant(by)
+	if p == nil {
+		return errNotConvParticipant
+	}
+	if !p.Role.canManage() {
+		return errConvNotAdmin
+	}
+	return nil
+}
+
+// AddParticipant adds user to the group conv. The user by must be an owner or
+// an admin of the conv.
+func (c *Convs) AddParticipant(ctx context.Context, db *sql.DB, by uid.ID, user *User) error {
+	if err := c.checkManager(by); err != nil {
+		return err
+	}
+	if c.HasParticipant(user.ID) {
+		return httperr.NewBadRequest("conv/already-participant", "User is already a participant of this conversation.")
+	}
+	if len(c.Participants)+1 > maxConvGroupMembersNum {
+		return httperr.NewBadRequest("conv/too-many-members", "Too many members.")
+	}
+	adder, err := GetUser(ctx, db, by, nil)
+	if err != nil {
+		return err
+	}
+	pending, err := checkCanAddToConv(ctx, db, adder, user)
+	if err != nil {
+		return err
+	}
+	return msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		return c.addParticipantTx(ctx, tx, user, ConvRoleMember, pending)
+	})
+}
+
+// RemoveParticipant removes user from the group conv. If by is user, user
+// leaves the conv. Otherwise by must be the owner or an admin of the conv, and
+// admins can only remove members. If the owner leaves, the participant who has
+// been in the conv the longest, preferring admins, becomes the new owner.
+func (c *Convs) RemoveParticipant(ctx context.Context, db *sql.DB, by, user uid.ID) error {
+	if !c.IsGroup {
+		return errConvNotGroup
+	}
+	removed := c.Participant(user)
+	if removed == nil {
+		return httperr.NewNotFound("conv/participant-not-found", "Participant not found.")
+	}
+	if by != user {
+		if err := c.checkManager(by); err != nil {
+			return err
+		}
+		if removed.Role == ConvRoleOwner || (removed.Role == ConvRoleAdmin && c.Participant(by).Role != ConvRoleOwner) {
+			return httperr.NewForbidden("conv/cannot-remove", "You cannot remove this participant.")
+		}
+	}
+
+	var newOwner *ConvParticipant
+	if removed.Role == ConvRoleOwner {
+		for _, p := range c.Participants {
+			if p == removed {
+				continue
+			}
+			if newOwner == nil || (p.Role == ConvRoleAdmin && newOwner.Role != ConvRoleAdmin) {
+				newOwner = p
+			}
+		}
+	}
+
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM conv_participants WHERE conv_id = ? AND user_id = ?", c.ID, user); err != nil {
+			return err
+		}
+		if newOwner != nil {
+			_, err := tx.ExecContext(ctx, "UPDATE conv_participants SET role = ? WHERE conv_id = ? AND user_id = ?", ConvRoleOwner, c.ID, newOwner.UserID)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if newOwner != nil {
+		newOwner.Role = ConvRoleOwner
+	}
+	c.Participants = slices.DeleteFunc(c.Participants, func(p *ConvParticipant) bool { return p == removed })
+	return nil
+}
+
+// SetParticipantRole changes the role of user in the group conv. Only the
+// owner of the conv can change roles. Making another participant the owner
+// transfers the ownership of the conv, and the previous owner becomes an admin.
+func (c *Convs) SetParticipantRole(ctx context.Context, db *sql.DB, by, user uid.ID, role ConvRole) error {
+	if !role.Valid() {
+		return httperr.NewBadRequest("conv/invalid-role", "Invalid role.")
+	}
+	if err := c.checkManager(by); err != nil {
+		return err
+	}
+	owner := c.Participant(by)
+	if owner.Role != ConvRoleOwner {
+		return httperr.NewForbidden("conv/not-owner", "Not the owner of this conversation.")
+	}
+	p := c.Participant(user)
+	if p == nil {
+		return httperr.NewNotFound("conv/participant-not-found", "Participant not found.")
+	}
+	if p == owner {
+		return httperr.NewBadRequest("conv/cannot-change-own-role", "Transfer the ownership to another participant instead.")
+	}
+
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE conv_participants SET role = ? WHERE conv_id = ? AND user_id = ?", role, c.ID, user); err != nil {
+			return err
+		}
+		if role == ConvRoleOwner {
+			_, err := tx.ExecContext(ctx, "UPDATE conv_participants SET role = ? WHERE conv_id = ? AND user_id = ?", ConvRoleAdmin, c.ID, by)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	p.Role = role
+	if role == ConvRoleOwner {
+		owner.Role = ConvRoleAdmin
+	}
+	return nil
+}
+
+// SetTitle changes the title of the group conv. The user by must be an owner or
+// an admin of the conv.
+func (c *Convs) SetTitle(ctx context.Context, db *sql.DB, by uid.ID, title string) error {
+	if err := c.checkManager(by); err != nil {
+		return err
+	}
+	title, err := validateConvTitle(title)
+	if err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, "UPDATE convs SET title = ? WHERE id = ?", title, c.ID); err != nil {
+		return err
+	}
+	c.Title = msql.NewNullString(title)
+	return nil
+}
@@ -0,0 +1,246 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// DMPrivacy is a user setting that controls who can start conversations with
+// the user.
+type DMPrivacy int
+
+const (
+	DMPrivacyEveryone   = DMPrivacy(iota)
+	DMPrivacyPoints     // Only users with at least User.DMMinPoints points.
+	DMPrivacyInteracted // Only users the user has interacted with.
+	DMPrivacyNobody
+)
+
+func (p DMPrivacy) Valid() bool {
+	_, err := p.MarshalText()
+	return err == nil
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (p DMPrivacy) MarshalText() ([]byte, error) {
+	switch p {
+	case DMPrivacyEveryone:
+		return []byte("everyone"), nil
+	case DMPrivacyPoints:
+		return []byte("points"), nil
+	case DMPrivacyInteracted:
+		return []byte("interacted"), nil
+	case DMPrivacyNobody:
+		return []byte("nobody"), nil
+	}
+	return nil, fmt.Errorf("cannot marshal unsupported DMPrivacy (%v)", int(p))
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (p *DMPrivacy) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "everyone":
+		*p = DMPrivacyEveryone
+	case "points":
+		*p = DMPrivacyPoints
+	case "interacted":
+		*p = DMPrivacyInteracted
+	case "nobody":
+		*p = DMPrivacyNobody
+	default:
+		return fmt.Errorf("cannot unmarshal unsupported DMPrivacy: %v", string(text))
+	}
+	return nil
+}
+
+// ConvStatus is the status of a one-to-one conv. A conv started by a user that
+// the target hasn't interacted with is a message request (ConvStatusPending)
+// until the target accepts or declines it.
+type ConvStatus string
+
+const (
+	ConvStatusAccepted = ConvStatus("accepted")
+	ConvStatusPending  = ConvStatus("pending")
+	ConvStatusDeclined = ConvStatus("declined")
+)
+
+// IsRequest reports whether c is a message request that's not yet accepted.
+func (c *Convs) IsRequest() bool {
+	return c.Status != ConvStatusAccepted
+}
+
+// checkCanMessage returns an error if target doesn't allow starter to start a
+// conversation with them. If starter is allowed to, but the conversation has
+// to be accepted by target first, request is true.
+func checkCanMessage(ctx context.Context, db *sql.DB, starter, target *User) (request bool, err error) {
+	muted, err := target.Muted(ctx, db, starter.ID)
+	if err != nil {
+		return false, err
+	}
+	if muted {
+		return false, httperr.NewForbidden("conv/user-muted", "User "+target.Username+" has muted you.")
+	}
+
+	if starter.Admin {
+		return false, nil
+	}
+
+	if target.DMPrivacy == DMPrivacyNobody {
+		return false, httperr.NewForbidden("conv/dms-off", "User "+target.Username+" doesn't accept messages.")
+	}
+	if target.DMPrivacy == DMPrivacyPoints && starter.Points < target.DMMinPoints {
+		return false, httperr.NewForbidden("conv/not-enough-points",
+			"User "+target.Username+" only accepts messages from users with at least "+strconv.Itoa(target.DMMinPoints)+" points.")
+	}
+
+	interacted, err := userInteractedWith(ctx, db, target.ID, starter.ID)
+	if err != nil {
+		return false, err
+	}
+	if !interacted && target.DMPrivacy == DMPrivacyInteracted {
+		return false, httperr.NewForbidden("conv/not-interacted", "User "+target.Username+" only accepts messages from users they've interacted with.")
+	}
+	return !interacted, nil
+}
+
+// userInteractedWith reports whether user has interacted with other, which is
+// to say user has sent a message in a conv that other is a participant of, or
+// user has commented on a post or replied to a comment of other.
+func userInteractedWith(ctx context.Context, db *sql.DB, user, other uid.ID) (bool, error) {
+	var interacted bool
+	err := db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM msg
+			INNER JOIN conv_participants AS p ON p.conv_id = msg.conv_id AND p.user_id = ?
+			WHERE msg.sender_id = ?
+		) OR EXISTS (
+			SELECT 1 FROM comments
+			INNER JOIN comments AS parents ON parents.id = comments.parent_id
+			WHERE comments.user_id = ? AND parents.user_id = ?
+		) OR EXISTS (
+			SELECT 1 FROM comments
+			INNER JOIN posts ON posts.id = comments.post_id
+			WHERE comments.user_id = ? AND posts.user_id = ?
+		)`, other, user, user, other, user, other).Scan(&interacted)
+	return interacted, err
+}
+
+// checkRequestTarget returns an error if c is not a message request sent to
+// user. A group conv is a request to the participants of it that are pending.
+func (c *Convs) checkRequestTarget(user uid.ID) error {
+	if c.IsGroup {
+		p := c.Participant(user)
+		if p == nil {
+			return errNotConvParticipant
+		}
+		if !p.Pending {
+			return httperr.NewBadRequest("conv/not-request", "Not a message request.")
+		}
+		return nil
+	}
+	if !c.User2ID.Valid || c.User2ID.ID != user {
+		return errNotConvParticipant
+	}
+	if c.Status == ConvStatusAccepted {
+		return httperr.NewBadRequest("conv/not-request", "Not a message request.")
+	}
+	return nil
+}
+
+func (c *Convs) setStatus(ctx context.Context, db *sql.DB, status ConvStatus) error {
+	if _, err := db.ExecContext(ctx, "UPDATE convs SET status = ? WHERE id = ?", status, c.ID); err != nil {
+		return err
+	}
+	c.Status = status
+	return nil
+}
+
+// acceptGroupInvite makes user, a pending participant of the group conv c, a
+// regular participant.
+func (c *Convs) acceptGroupInvite(ctx context.Context, db *sql.DB, user uid.ID) error {
+	if _, err := db.ExecContext(ctx, "UPDATE conv_participants SET pending = FALSE WHERE conv_id = ? AND user_id = ?", c.ID, user); err != nil {
+		return err
+	}
+	if p := c.Participant(user); p != nil {
+		p.Pending = false
+	}
+	return nil
+}
+
+// AcceptRequest accepts the message request c on behalf of user, who has to be
+// its target. Accepting a previously declined request is allowed.
+func (c *Convs) AcceptRequest(ctx context.Context, db *sql.DB, user uid.ID) error {
+	if err := c.checkRequestTarget(user); err != nil {
+		return err
+	}
+	if c.IsGroup {
+		return c.acceptGroupInvite(ctx, db, user)
+	}
+	return c.setStatus(ctx, db, ConvStatusAccepted)
+}
+
+// DeclineRequest declines the message request c on behalf of user, who has to
+// be its target. The starter of a declined request cannot send any more
+// messages to the conv. Declining a group conv removes user from it.
+func (c *Convs) DeclineRequest(ctx context.Context, db *sql.DB, user uid.ID) error {
+	if err := c.checkRequestTarget(user); err != nil {
+		return err
+	}
+	if c.IsGroup {
+		return c.RemoveParticipant(ctx, db, user, user)
+	}
+	return c.setStatus(ctx, db, ConvStatusDeclined)
+}
+
+// ReportRequest declines the message request c on behalf of user, who has to be
+// its target, and reports its starter to the admins. The reason is the ID of a
+// report reason.
+func (c *Convs) ReportRequest(ctx context.Context, db *sql.DB, user uid.ID, reason int) error {
+	if err := c.checkRequestTarget(user); err != nil {
+		return err
+	}
+	var exists bool
+	if err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM report_reasons WHERE id = ?)", reason).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return httperr.NewBadRequest("invalid_report_reason", "Invalid report reason.")
+	}
+	reported := c.User1ID
+	if c.IsGroup {
+		for _, p := range c.Participants {
+			if p.Role == ConvRoleOwner {
+				reported = p.UserID
+			}
+		}
+	}
+	if _, err := db.ExecContext(ctx, "INSERT IGNORE INTO conv_reports (conv_id, reported_user, reason_id, created_by) VALUES (?, ?, ?, ?)",
+		c.ID, reported, reason, user); err != nil {
+		return err
+	}
+	if c.IsGroup {
+		return c.RemoveParticipant(ctx, db, user, user)
+	}
+	return c.setStatus(ctx, db, ConvStatusDeclined)
+}
+
+// GetUsersConvRequests returns the pending message requests sent to user, and
+// the group convs user is a pending participant of, most recent first.
+func GetUsersConvRequests(ctx context.Context, db *sql.DB, user uid.ID) ([]*Convs, error) {
+	where := `WHERE (convs.user2_id = ? AND convs.status = ?)
+		OR convs.id IN (SELECT conv_id FROM conv_participants WHERE user_id = ? AND pending = TRUE)
+		ORDER BY convs.started_at DESC`
+	convs, err := getConvs(ctx, db, where, user, ConvStatusPending, user)
+	if err != nil {
+		return nil, err
+	}
+	if err = fillUnreadCounts(ctx, db, user, convs); err != nil {
+		return nil, err
+	}
+	return convs, nil
+}
@@ -1,36 +1,57 @@
 package core
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
+	"unicode/utf8"
 
 	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/images"
 	msql "github.com/discuitnet/discuit/internal/sql"
 	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/discuitnet/discuit/internal/utils"
 )
 
-// TODO Update the schema to also include LastUpdated
+// Convs is a conversation. It's either between two users, in which case
+// User1ID is the starter and User2ID is the target, or it's a group conv
+// (IsGroup is true), in which case User1ID is the creator and User2ID is null.
+// In both cases Participants holds all the current members of the conv.
 type Convs struct {
-	ID              uid.ID       `json:"id"`
-	User1ID         uid.ID       `json:"user1Id"`
-	Username1       string       `json:"username1"` // Not in the table
-	User2ID         uid.ID       `json:"user2Id"`
-	Username2       string       `json:"username2"` // Not in the table
-	StartedAt       time.Time    `json:"startedAt"`
-	LastMessage     uid.NullID   `json:"lastMessage"`
-	LastUpdated     sql.NullTime `json:"lastUpdated"`
-	LastSeenByUser1 sql.NullTime `json:"lastSeenByUser1"`
-	LastSeenByUser2 sql.NullTime `json:"lastSeenByUser2"`
-	NumMessages     uint64       `json:"numMessages"`
+	ID              uid.ID          `json:"id"`
+	Title           msql.NullString `json:"title"`
+	IsGroup         bool            `json:"isGroup"`
+	Status          ConvStatus      `json:"status"`
+	User1ID         uid.ID          `json:"user1Id"`
+	Username1       string          `json:"username1"` // Not in the table
+	User2ID         uid.NullID      `json:"user2Id"`
+	Username2       msql.NullString `json:"username2"` // Not in the table
+	StartedAt       time.Time       `json:"startedAt"`
+	LastMessage     uid.NullID      `json:"lastMessage"`
+	LastUpdated     sql.NullTime    `json:"lastUpdated"`
+	LastSeenByUser1 sql.NullTime    `json:"lastSeenByUser1"`
+	LastSeenByUser2 sql.NullTime    `json:"lastSeenByUser2"`
+	NumMessages     uint64          `json:"numMessages"`
+
+	Participants []*ConvParticipant `json:"participants"`
+
+	// The number of messages of the conv not yet seen by the user whose convs
+	// were fetched. Only set by GetUsersConvs.
+	NumUnread int `json:"numUnread"`
 }
 
 // getConvs executes a Select query by using the where parameter.
 func getConvs(ctx context.Context, db *sql.DB, where string, args ...any) ([]*Convs, error) {
 	query := msql.BuildSelectQuery("convs", []string{
 		"convs.id",
+		"convs.title",
+		"convs.is_group",
+		"convs.status",
 		"convs.user1_id",
 		"u1.username",
 		"convs.user2_id",
@@ -43,7 +64,7 @@ func getConvs(ctx context.Context, db *sql.DB, where string, args ...any) ([]*Co
 		"convs.num_msgs",
 	}, []string{
 		"INNER JOIN users as u1 on convs.user1_id = u1.id",
-		"INNER JOIN users as u2 on convs.user2_id = u2.id",
+		"LEFT JOIN users as u2 on convs.user2_id = u2.id",
 	}, where)
 
 	rows, err := db.QueryContext(ctx, query, args...)
@@ -58,6 +79,9 @@ func getConvs(ctx context.Context, db *sql.DB, where string, args ...any) ([]*Co
 		conv := &Convs{}
 		err = rows.Scan(
 			&conv.ID,
+			&conv.Title,
+			&conv.IsGroup,
+			&conv.Status,
 			&conv.User1ID,
 			&conv.Username1,
 			&conv.User2ID,
@@ -79,19 +103,65 @@ func getConvs(ctx context.Context, db *sql.DB, where string, args ...any) ([]*Co
 		return nil, err
 	}
 
+	if err = fillConvParticipants(ctx, db, convs); err != nil {
+		return nil, err
+	}
 	return convs, nil
 }
 
-// GetUsersConvs returns all the convs of the user. The convs are sorted by the date
-// they were started in descending order.
+// GetUsersConvs returns all the convs of the user, except for the message
+// requests sent to the user, and the group convs the user is a pending
+// participant of, that are not yet accepted (see GetUsersConvRequests). The
+// convs are sorted by the date they were started in descending order.
 func GetUsersConvs(ctx context.Context, db *sql.DB, userId *uid.ID) ([]*Convs, error) {
-	convs, err := getConvs(ctx, db, "WHERE convs.user1_id = ? OR convs.user2_id = ? ORDER BY convs.started_at DESC", userId, userId)
+	where := `WHERE convs.id IN (SELECT conv_id FROM conv_participants WHERE user_id = ? AND pending = FALSE)
+		AND NOT (convs.status <> ? AND convs.user2_id <=> ?)
+		ORDER BY convs.started_at DESC`
+	convs, err := getConvs(ctx, db, where, userId, ConvStatusAccepted, userId)
 	if err != nil {
 		return nil, err
 	}
+	if err = fillUnreadCounts(ctx, db, *userId, convs); err != nil {
+		return nil, err
+	}
 	return convs, nil
 }
 
+// fillUnreadCounts sets the NumUnread field of convs to the number of messages
+// sent by others that user hasn't yet seen.
+func fillUnreadCounts(ctx context.Context, db *sql.DB, user uid.ID, convs []*Convs) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT p.conv_id, COUNT(msg.id)
+		FROM conv_participants AS p
+		INNER JOIN msg ON msg.conv_id = p.conv_id AND msg.sender_id <> p.user_id AND (p.last_seen_msg IS NULL OR msg.id > p.last_seen_msg)
+		WHERE p.user_id = ?
+		GROUP BY p.conv_id`, user)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	counts := make(map[uid.ID]int)
+	for rows.Next() {
+		var (
+			convID uid.ID
+			count  int
+		)
+		if err := rows.Scan(&convID, &count); err != nil {
+			return err
+		}
+		counts[convID] = count
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, conv := range convs {
+		conv.NumUnread = counts[conv.ID]
+	}
+	return nil
+}
+
 // GetConvUserIDs returns the conv with the given user ids
 func GetConvUserIDs(ctx context.Context, db *sql.DB, user1ID, user2ID *uid.NullID) (*Convs, error) {
 	convs, err := getConvs(ctx, db, "WHERE convs.user1_id = ? AND convs.user2_id = ?", user1ID, user2ID)
@@ -116,36 +186,45 @@ func GetConvID(ctx context.Context, db *sql.DB, id uid.NullID) (*Convs, error) {
 }
 
 // CreateConv creates a new conversation between the given user ids if the conv
-// does not already exist.
+// does not already exist. It returns an error if the DM privacy setting of
+// target doesn't allow starter to message them. If target hasn't interacted
+// with starter before, the conv is created as a message request.
 func CreateConv(ctx context.Context, db *sql.DB, starter, target *User) (*Convs, error) {
-	// check if the starter has been muted by the target.
-	muted, err := target.MutedBy(ctx, db, starter.ID)
+	request, err := checkCanMessage(ctx, db, starter, target)
 	if err != nil {
 		return nil, err
 	}
-	if muted {
-		return nil, httperr.NewBadRequest("conv/user-muted", "User has muted you.")
-	}
 
 	var conv Convs
 	conv.ID = uid.New()
+	conv.Status = ConvStatusAccepted
+	if request {
+		conv.Status = ConvStatusPending
+	}
 	conv.User1ID = starter.ID
 	conv.Username1 = starter.Username
-	conv.User2ID = target.ID
-	conv.Username2 = target.Username
+	conv.User2ID = uid.NullID{ID: target.ID, Valid: true}
+	conv.Username2 = msql.NewNullString(target.Username)
+	conv.StartedAt = time.Now()
 	conv.NumMessages = 0
 
 	query, args := msql.BuildInsertQuery("convs", []msql.ColumnValue{
 		{Name: "id", Value: conv.ID},
 		{Name: "user1_id", Value: conv.User1ID},
 		{Name: "user2_id", Value: conv.User2ID},
+		{Name: "status", Value: conv.Status},
+		{Name: "started_at", Value: conv.StartedAt},
 		{Name: "num_msgs", Value: conv.NumMessages},
 	})
-	_, err = db.ExecContext(ctx, query, args...)
-	if err != nil {
-		return nil, err
-	}
-
+	err = msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+		if err := conv.addParticipantTx(ctx, tx, starter, ConvRoleOwner, false); err != nil {
+			return err
+		}
+		return conv.addParticipantTx(ctx, tx, target, ConvRoleMember, false)
+	})
 	if msql.IsErrDuplicateErr(err) {
 		return nil, &httperr.Error{
 			HTTPStatus: http.StatusConflict,
@@ -153,9 +232,182 @@ func CreateConv(ctx context.Context, db *sql.DB, starter, target *User) (*Convs,
 			Message:    "A conversation between these users already exists.",
 		}
 	}
+	if err != nil {
+		return nil, err
+	}
 	return &conv, nil
 }
 
+// SendMessage creates a new message in the conv sent by sender. For
+// conversations between two users, the receiver of the message is derived from
+// the conv; group messages have no single receiver. It returns an error if
+// sender is not a participant of the conv or if the receiver has muted the
+// sender.
+//
+// The starter of a message request can send only one message until the request
+// is accepted. A message sent by the target of a request accepts the request.
+//
+// The images imageIDs, which have to be uploaded by sender with
+// SaveMessageImage, are attached to the message. Either body or imageIDs must
+// not be empty.
+//
+// The optional clientID is an ID generated by the client of sender to make
+// sends idempotent; see MessageByClientID.
+func (c *Convs) SendMessage(ctx context.Context, db *sql.DB, sender uid.ID, body string, imageIDs []uid.ID, clientID string) (*Message, error) {
+	if !c.HasParticipant(sender) {
+		return nil, errNotConvParticipant
+	}
+	if len(clientID) > maxMessageClientIDLength {
+		return nil, httperr.NewBadRequest("msg/invalid-client-id", "Message client ID too long.")
+	}
+	if body == "" && len(imageIDs) == 0 {
+		return nil, httperr.NewBadRequest("msg/empty-body", "Message body cannot be empty.")
+	}
+	if err := validateMessageBody(body); err != nil {
+		return nil, err
+	}
+	if err := checkMessageImages(ctx, db, sender, imageIDs); err != nil {
+		return nil, err
+	}
+
+	var receiver uid.NullID
+	if p := c.Participant(sender); p.Pending {
+		// Sending a message to a group conv accepts the invitation.
+		if err := c.acceptGroupInvite(ctx, db, sender); err != nil {
+			return nil, err
+		}
+	}
+	if !c.IsGroup {
+		receiver = uid.NullID{ID: c.OtherParticipant(sender), Valid: true}
+		muted, err := UserMuted(ctx, db, receiver.ID, sender)
+		if err != nil {
+			return nil, err
+		}
+		if muted {
+			return nil, httperr.NewForbidden("conv/user-muted", "User has muted you.")
+		}
+		if c.IsRequest() {
+			if sender == c.User1ID {
+				if c.Status == ConvStatusDeclined {
+					return nil, httperr.NewForbidden("conv/request-declined", "Your message request was declined.")
+				}
+				if c.NumMessages > 0 {
+					return nil, httperr.NewForbidden("conv/request-pending", "Your message request is not yet accepted.")
+				}
+			} else if err := c.setStatus(ctx, db, ConvStatusAccepted); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var msg *Message
+	now := time.Now()
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) (err error) {
+		if msg, err = createMessageTx(ctx, tx, c.ID, sender, receiver, body, imageIDs, clientID); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE convs SET last_message = ?, last_updated = ?, num_msgs = num_msgs + 1 WHERE id = ?", msg.ID, now, c.ID)
+		return err
+	})
+	if msql.IsErrDuplicateErr(err) {
+		return nil, ErrMessageExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := fillMessageImages(ctx, db, []*Message{msg}); err != nil {
+		return nil, err
+	}
+
+	c.LastMessage = uid.NullID{ID: msg.ID, Valid: true}
+	c.LastUpdated = sql.NullTime{Time: now, Valid: true}
+	c.NumMessages++
+	return msg, nil
+}
+
+// ConvSeen is a read receipt of a conv.
+type ConvSeen struct {
+	ConvID uid.ID `json:"convId"`
+	UserID uid.ID `json:"userId"` // The user who saw the messages.
+
+	// If not null, only messages up to (and including) this message were
+	// seen. Otherwise all messages of the conv were seen.
+	MessageID uid.NullID `json:"messageId"`
+
+	SeenAt time.Time `json:"seenAt"`
+}
+
+// MarkSeen marks the messages of the conv sent by others as seen by user. If
+// upTo is not nil, only the messages up to (and including) the message upTo are
+// marked as seen.
+func (c *Convs) MarkSeen(ctx context.Context, db *sql.DB, user uid.ID, upTo *uid.ID) (*ConvSeen, error) {
+	participant := c.Participant(user)
+	if participant == nil {
+		return nil, errNotConvParticipant
+	}
+
+	seen := &ConvSeen{
+		ConvID: c.ID,
+		UserID: user,
+		SeenAt: time.Now(),
+	}
+
+	lastSeen := c.LastMessage
+	where, args := "WHERE conv_id = ? AND receiver_id = ? AND seen = false", []any{c.ID, user}
+	if upTo != nil {
+		var count int
+		if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM msg WHERE id = ? AND conv_id = ?", *upTo, c.ID).Scan(&count); err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, httperr.NewBadRequest("conv/invalid-message", "Message is not of this conversation.")
+		}
+		where += " AND id <= ?"
+		args = append(args, *upTo)
+		seen.MessageID = uid.NullID{ID: *upTo, Valid: true}
+		lastSeen = seen.MessageID
+	}
+
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE msg SET seen = true "+where, args...); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE conv_participants SET
+				last_seen_at = ?,
+				last_seen_msg = CASE WHEN last_seen_msg IS NULL OR last_seen_msg < ? THEN ? ELSE last_seen_msg END
+			WHERE conv_id = ? AND user_id = ?`,
+			seen.SeenAt, lastSeen, lastSeen, c.ID, user); err != nil {
+			return err
+		}
+		if c.IsGroup {
+			return nil
+		}
+		column := "last_seen_by_user1"
+		if c.User2ID.Valid && c.User2ID.ID == user {
+			column = "last_seen_by_user2"
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE convs SET "+column+" = ? WHERE id = ?", seen.SeenAt, c.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	participant.LastSeenAt = msql.NewNullTime(seen.SeenAt)
+	if lastSeen.Valid && (!participant.LastSeenMessage.Valid || bytes.Compare(participant.LastSeenMessage.ID.Bytes(), lastSeen.ID.Bytes()) < 0) {
+		participant.LastSeenMessage = lastSeen
+	}
+	if !c.IsGroup {
+		if c.User2ID.Valid && c.User2ID.ID == user {
+			c.LastSeenByUser2 = sql.NullTime{Time: seen.SeenAt, Valid: true}
+		} else {
+			c.LastSeenByUser1 = sql.NullTime{Time: seen.SeenAt, Valid: true}
+		}
+	}
+	return seen, nil
+}
+
 // Update updates the last_message, last_seen_by_user fields, and num_msgs of the convs object.
 func (c *Convs) Update(ctx context.Context, db *sql.DB) error {
 	_, err := db.ExecContext(ctx, `
@@ -168,7 +420,7 @@ func (c *Convs) Update(ctx context.Context, db *sql.DB) error {
 		c.LastMessage,
 		c.LastSeenByUser1,
 		c.LastSeenByUser2,
-		c.LastMessage,
+		c.NumMessages,
 		c.ID)
 	return err
 }
@@ -187,16 +439,61 @@ func (c *Convs) UnmarshallUpdatableFieldsJSON(data []byte) error {
 	return nil
 }
 
-// Delete deletes the conversation from the database
+// Delete deletes the conv, along with all its messages and their images. For
+// group convs, only the owner can delete the conv; otherwise either participant
+// can.
+func (c *Convs) Delete(ctx context.Context, db *sql.DB, user uid.ID) error {
+	participant := c.Participant(user)
+	if participant == nil {
+		return errNotConvParticipant
+	}
+	if c.IsGroup && participant.Role != ConvRoleOwner {
+		return httperr.NewForbidden("conv/not-owner", "Only the owner can delete this conversation.")
+	}
+
+	return msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		// convs.last_message references a message of the conv.
+		if _, err := tx.ExecContext(ctx, "UPDATE convs SET last_message = NULL WHERE id = ?", c.ID); err != nil {
+			return err
+		}
+		if err := deleteMessagesImagesTx(ctx, tx, db, "WHERE conv_id = ?", c.ID); err != nil {
+			return err
+		}
+		for _, table := range []string{"msg", "conv_participants", "conv_reports"} {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE conv_id = ?", c.ID); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM convs WHERE id = ?", c.ID)
+		return err
+	})
+}
+
+// maxMessageBodyLength is the maximum length, in runes, of the body of a
+// message.
+const maxMessageBodyLength = 5000
+
+// validateMessageBody returns an error if body is too long.
+func validateMessageBody(body string) error {
+	if utf8.RuneCountInString(body) > maxMessageBodyLength {
+		return httperr.NewBadRequest("msg/body-too-long", fmt.Sprintf("Message body cannot be longer than %d characters.", maxMessageBodyLength))
+	}
+	return nil
+}
 
 type Message struct {
 	ID         uid.ID          `json:"id"`
 	ConvID     uid.ID          `json:"convId"`
 	SenderID   uid.ID          `json:"senderId"`
-	ReceiverID uid.ID          `json:"receiverId"`
+	ClientID   msql.NullString `json:"-"`          // Set by the client of the sender to make sends idempotent; only sent back in acks.
+	ReceiverID uid.NullID      `json:"receiverId"` // Null for group messages.
 	SentAt     time.Time       `json:"sentAt"`
+	EditedAt   msql.NullTime   `json:"editedAt"`
+	DeletedAt  msql.NullTime   `json:"deletedAt"`
 	Seen       bool            `json:"seen"`
-	Body       msql.NullString `json:"body"`
+	Body       msql.NullString `json:"body"` // Null if the message is deleted.
+
+	Images []*images.Image `json:"images"`
 }
 
 func getMessages(ctx context.Context, db *sql.DB, where string, args ...any) ([]*Message, error) {
@@ -204,8 +501,11 @@ func getMessages(ctx context.Context, db *sql.DB, where string, args ...any) ([]
 		"msg.id",
 		"msg.conv_id",
 		"msg.sender_id",
+		"msg.client_id",
 		"msg.receiver_id",
 		"msg.sent_at",
+		"msg.edited_at",
+		"msg.deleted_at",
 		"msg.seen",
 		"msg.body",
 	}, []string{}, where)
@@ -218,13 +518,16 @@ func getMessages(ctx context.Context, db *sql.DB, where string, args ...any) ([]
 
 	msgs := []*Message{}
 	for rows.Next() {
-		msg := &Message{}
+		msg := &Message{Images: []*images.Image{}}
 		err = rows.Scan(
 			&msg.ID,
 			&msg.ConvID,
 			&msg.SenderID,
+			&msg.ClientID,
 			&msg.ReceiverID,
 			&msg.SentAt,
+			&msg.EditedAt,
+			&msg.DeletedAt,
 			&msg.Seen,
 			&msg.Body,
 		)
@@ -238,19 +541,175 @@ func getMessages(ctx context.Context, db *sql.DB, where string, args ...any) ([]
 		return nil, err
 	}
 
+	if err = fillMessageImages(ctx, db, msgs); err != nil {
+		return nil, err
+	}
 	return msgs, nil
 }
 
-// GetConvMessages returns all the messages that belong to the given conv
-func GetConvMessages(ctx context.Context, db *sql.DB, convId uid.ID) ([]*Message, error) {
-	msgs, err := getMessages(ctx, db, "WHERE msg.conv_id = ? ORDER BY msg.sent_at", convId)
+var ErrInvalidMessagesCursor = httperr.NewBadRequest("invalid_cursor", "Invalid messages pagination cursor.")
+
+// MessagesOptions select a page of the messages of a conv. At most one of
+// Before, After, and Around should be set. If none is set, the latest messages
+// of the conv are returned.
+type MessagesOptions struct {
+	Before *uid.ID // Messages older than Before.
+	After  *uid.ID // Messages newer than After.
+	Around *uid.ID // Messages surrounding (and including) the message Around.
+	Limit  int
+}
+
+// MessagesResultSet is a page of messages of a conv. Messages are always in
+// chronological order.
+//
+// Before and After are pagination cursors to fetch the older and newer messages
+// respectively. They are empty if there are no more messages in that direction.
+type MessagesResultSet struct {
+	Messages []*Message `json:"messages"`
+	Before   string     `json:"before"`
+	After    string     `json:"after"`
+}
+
+// ParseMessagesCursor parses a pagination cursor of MessagesResultSet. If text
+// is empty, it returns nil.
+func ParseMessagesCursor(text string) (*uid.ID, error) {
+	if text == "" || text == "null" || text == "undefined" {
+		return nil, nil
+	}
+	id := new(uid.ID)
+	if err := id.UnmarshalText([]byte(text)); err != nil {
+		return nil, ErrInvalidMessagesCursor
+	}
+	return id, nil
+}
+
+// getMessagesBefore returns at most limit+1 messages of the conv sent before
+// the message before (or the latest messages if before is nil), newest first.
+// If inclusive is true, the message before itself is included.
+func getMessagesBefore(ctx context.Context, db *sql.DB, convID uid.ID, before *uid.ID, inclusive bool, limit int) ([]*Message, error) {
+	where, args := "WHERE msg.conv_id = ? ", []any{convID}
+	if before != nil {
+		if inclusive {
+			where += "AND msg.id <= ? "
+		} else {
+			where += "AND msg.id < ? "
+		}
+		args = append(args, *before)
+	}
+	where += "ORDER BY msg.id DESC LIMIT ?"
+	args = append(args, limit+1)
+	return getMessages(ctx, db, where, args...)
+}
+
+// getMessagesAfter returns at most limit+1 messages of the conv sent after the
+// message after, oldest first.
+func getMessagesAfter(ctx context.Context, db *sql.DB, convID uid.ID, after uid.ID, limit int) ([]*Message, error) {
+	return getMessages(ctx, db, "WHERE msg.conv_id = ? AND msg.id > ? ORDER BY msg.id LIMIT ?", convID, after, limit+1)
+}
+
+func reverseMessages(msgs []*Message) {
+	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	}
+}
+
+// GetConvMessages returns a page of the messages that belong to the given
+// conv. Message IDs are used as cursors, since they're ordered by the time they
+// were created.
+func GetConvMessages(ctx context.Context, db *sql.DB, convId uid.ID, opts *MessagesOptions) (*MessagesResultSet, error) {
+	limit := opts.Limit
+	if limit < 1 {
+		return nil, errors.New("messages limit cannot be less than 1")
+	}
+
+	var (
+		older, newer           []*Message // older is newest first, newer is oldest first.
+		olderLimit, newerLimit int
+		err                    error
+	)
+	switch {
+	case opts.After != nil:
+		newerLimit = limit
+		if newer, err = getMessagesAfter(ctx, db, convId, *opts.After, newerLimit); err != nil {
+			return nil, err
+		}
+	case opts.Around != nil:
+		newerLimit = limit / 2
+		olderLimit = limit - newerLimit
+		if older, err = getMessagesBefore(ctx, db, convId, opts.Around, true, olderLimit); err != nil {
+			return nil, err
+		}
+		if len(older) == 0 || older[0].ID != *opts.Around {
+			return nil, httperr.NewNotFound("msg-not-found", "Message not found.")
+		}
+		if newer, err = getMessagesAfter(ctx, db, convId, *opts.Around, newerLimit); err != nil {
+			return nil, err
+		}
+	default:
+		olderLimit = limit
+		if older, err = getMessagesBefore(ctx, db, convId, opts.Before, false, olderLimit); err != nil {
+			return nil, err
+		}
+	}
+
+	moreOlder, moreNewer := len(older) > olderLimit, len(newer) > newerLimit
+	if moreOlder {
+		older = older[:olderLimit]
+	}
+	if moreNewer {
+		newer = newer[:newerLimit]
+	}
+	// The messages at the cursors themselves are on the other side of the page.
+	moreOlder = moreOlder || opts.After != nil
+	moreNewer = moreNewer || opts.Before != nil
+
+	reverseMessages(older)
+	set := &MessagesResultSet{Messages: append(older, newer...)}
+	if n := len(set.Messages); n > 0 {
+		if moreOlder {
+			set.Before = set.Messages[0].ID.String()
+		}
+		if moreNewer {
+			set.After = set.Messages[n-1].ID.String()
+		}
+	}
+	if set.Messages == nil {
+		set.Messages = []*Message{} // for the json "[]" output
+	}
+	return set, nil
+}
+
+// maxMessageClientIDLength is the maximum length of the client ID of a message.
+const maxMessageClientIDLength = 64
+
+// MessageByClientID returns the message of the conv sent by sender with the
+// client ID clientID. It returns nil if there's no such message.
+func (c *Convs) MessageByClientID(ctx context.Context, db *sql.DB, sender uid.ID, clientID string) (*Message, error) {
+	msgs, err := getMessages(ctx, db, "WHERE msg.sender_id = ? AND msg.client_id = ? AND msg.conv_id = ?", sender, clientID, c.ID)
 	if err != nil {
 		return nil, err
 	}
 	if len(msgs) == 0 {
-		return nil, httperr.NewNotFound("msgs-not-found", "Messages not found for this conversation.")
+		return nil, nil
 	}
-	return msgs, nil
+	return msgs[0], nil
+}
+
+// GetUserMessagesAfter returns, oldest first, at most limit messages newer than
+// the message after from all the convs of user (except for the group convs the
+// user has a pending invitation to). The second return value reports whether
+// there are more messages.
+func GetUserMessagesAfter(ctx context.Context, db *sql.DB, user, after uid.ID, limit int) ([]*Message, bool, error) {
+	msgs, err := getMessages(ctx, db, `
+		WHERE msg.conv_id IN (SELECT conv_id FROM conv_participants WHERE user_id = ? AND pending = FALSE) AND msg.id > ?
+		ORDER BY msg.id LIMIT ?`, user, after, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(msgs) > limit {
+		return msgs[:limit], true, nil
+	}
+	return msgs, false, nil
 }
 
 // GetMessage returns the message with the given id
@@ -265,34 +724,170 @@ func GetMessage(ctx context.Context, db *sql.DB, id uid.NullID) (*Message, error
 	return msgs[0], nil
 }
 
-// CreateMessage creates a new message with the given parameters and inserts it
-// into the table.
-func CreateMessage(ctx context.Context, db *sql.DB, convId, senderId, receiverId uid.ID, body string) (*Message, error) {
+// createMessageTx inserts a new message, and attaches the images imageIDs to
+// it, within tx. The images imageIDs have to be temp images saved with
+// SaveMessageImage. If clientID is not empty, and the sender already has a
+// message in the conv with the same client ID, the insert fails with a
+// duplicate key error. The Images field of the returned message is left empty
+// (see fillMessageImages).
+func createMessageTx(ctx context.Context, tx *sql.Tx, convId, senderId uid.ID, receiverId uid.NullID, body string, imageIDs []uid.ID, clientID string) (*Message, error) {
 	var msg Message
 	msg.ID = uid.New()
 	msg.ConvID = convId
 	msg.SenderID = senderId
+	msg.ClientID = msql.NewNullString(msql.NilIfEmptyString(clientID))
 	msg.ReceiverID = receiverId
+	msg.SentAt = time.Now()
 	msg.Body = msql.NewNullString(body)
 
 	query, args := msql.BuildInsertQuery("msg", []msql.ColumnValue{
 		{Name: "id", Value: msg.ID},
 		{Name: "conv_id", Value: msg.ConvID},
 		{Name: "sender_id", Value: msg.SenderID},
+		{Name: "client_id", Value: msg.ClientID},
 		{Name: "receiver_id", Value: msg.ReceiverID},
+		{Name: "sent_at", Value: msg.SentAt},
 		{Name: "body", Value: msg.Body},
 	})
-	_, err := db.ExecContext(ctx, query, args...)
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, err
+	}
+	if err := attachMessageImagesTx(ctx, tx, msg.ID, imageIDs); err != nil {
+		return nil, err
+	}
+	msg.Images = []*images.Image{}
+	return &msg, nil
+}
+
+// Deleted reports whether the message was deleted.
+func (m *Message) Deleted() bool {
+	return m.DeletedAt.Valid
+}
+
+// getOwnMessage returns the message of the conv with the ID msgID. It returns
+// an error if the message was not sent by user or if it was deleted.
+func (c *Convs) getOwnMessage(ctx context.Context, db *sql.DB, user, msgID uid.ID) (*Message, error) {
+	if !c.HasParticipant(user) {
+		return nil, errNotConvParticipant
+	}
+	msgs, err := getMessages(ctx, db, "WHERE msg.id = ? AND msg.conv_id = ?", msgID, c.ID)
 	if err != nil {
 		return nil, err
 	}
+	if len(msgs) == 0 {
+		return nil, httperr.NewNotFound("msg-not-found", "Message not found.")
+	}
+	msg := msgs[0]
+	if msg.SenderID != user {
+		return nil, httperr.NewForbidden("msg/not-sender", "Not your message.")
+	}
+	if msg.Deleted() {
+		return nil, httperr.NewBadRequest("msg/deleted", "Message deleted.")
+	}
+	return msg, nil
+}
 
-	if msql.IsErrDuplicateErr(err) {
-		return nil, &httperr.Error{
-			HTTPStatus: http.StatusConflict,
-			Code:       "duplicate-row",
-			Message:    "This message already exists.",
+// EditMessage changes the body of the message of the conv with the ID msgID.
+// Only the sender of a message can edit it.
+func (c *Convs) EditMessage(ctx context.Context, db *sql.DB, editor, msgID uid.ID, body string) (*Message, error) {
+	if body == "" {
+		return nil, httperr.NewBadRequest("msg/empty-body", "Message body cannot be empty.")
+	}
+	if err := validateMessageBody(body); err != nil {
+		return nil, err
+	}
+	msg, err := c.getOwnMessage(ctx, db, editor, msgID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if _, err := db.ExecContext(ctx, "UPDATE msg SET body = ?, edited_at = ? WHERE id = ?", body, now, msg.ID); err != nil {
+		return nil, err
+	}
+	msg.Body = msql.NewNullString(body)
+	msg.EditedAt = msql.NewNullTime(now)
+	return msg, nil
+}
+
+// DeleteMessage deletes the message of the conv with the ID msgID. Only the
+// sender of a message can delete it. The row of the message is kept, as a
+// tombstone, but its body is cleared and its images are deleted.
+func (c *Convs) DeleteMessage(ctx context.Context, db *sql.DB, deleter, msgID uid.ID) (*Message, error) {
+	msg, err := c.getOwnMessage(ctx, db, deleter, msgID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if err := deleteMessagesImagesTx(ctx, tx, db, "WHERE id = ?", msg.ID); err != nil {
+			return err
 		}
+		_, err := tx.ExecContext(ctx, "UPDATE msg SET body = NULL, deleted_at = ? WHERE id = ?", now, msg.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	return &msg, nil
+	msg.Body = msql.NullString{}
+	msg.Images = []*images.Image{}
+	msg.DeletedAt = msql.NewNullTime(now)
+	return msg, nil
+}
+
+// maxMessagePushBodyLength is the maximum length, in runes, of the preview of
+// a message sent in web push notifications.
+const maxMessagePushBodyLength = 200
+
+// SendMessagePushNotification sends a web push notification of the message msg
+// of the conv to user, unless user turned off push notifications for direct
+// messages or the conv is a message request. Notifications of the same conv
+// collapse into one.
+func (c *Convs) SendMessagePushNotification(ctx context.Context, db *sql.DB, user uid.ID, msg *Message) error {
+	if c.IsRequest() {
+		return nil
+	}
+	if p := c.Participant(user); p == nil || p.Pending {
+		return nil // Not yet accepted the invitation to the group.
+	}
+
+	var off bool
+	if err := db.QueryRowContext(ctx, "SELECT dm_push_notifications_off FROM users WHERE id = ?", user).Scan(&off); err != nil {
+		return err
+	}
+	if off {
+		return nil
+	}
+
+	options := webPushOptions(c.ID.String(), 60*60*24)
+	if options == nil {
+		return nil
+	}
+
+	payload := struct {
+		Type           string          `json:"type"`
+		ConvID         uid.ID          `json:"convId"`
+		ConvTitle      msql.NullString `json:"convTitle"`
+		MessageID      uid.ID          `json:"messageId"`
+		SenderID       uid.ID          `json:"senderId"`
+		SenderUsername string          `json:"senderUsername"`
+		Body           string          `json:"body"`
+	}{
+		Type:      "new_message",
+		ConvID:    c.ID,
+		ConvTitle: c.Title,
+		MessageID: msg.ID,
+		SenderID:  msg.SenderID,
+		Body:      utils.TruncateUnicodeString(msg.Body.String, maxMessagePushBodyLength),
+	}
+	if sender := c.Participant(msg.SenderID); sender != nil {
+		payload.SenderUsername = sender.Username
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return SendPushNotification(ctx, db, user, data, options)
 }
@@ -0,0 +1,40 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+func TestConvDeleteWithMessages(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	user1, user2 := newTestUser(t, db), newTestUser(t, db)
+	conv, err := CreateConv(ctx, db, user1, user2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conv.SendMessage(ctx, db, user1.ID, "Hello", nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conv.SendMessage(ctx, db, user2.ID, "Hi", nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := conv.Delete(ctx, db, user1.ID); err != nil {
+		t.Fatalf("deleting a conv with messages: %v", err)
+	}
+	if _, err := GetConvID(ctx, db, uid.NullID{ID: conv.ID, Valid: true}); !httperr.IsNotFound(err) {
+		t.Errorf("conv not deleted (GetConvID error: %v)", err)
+	}
+	var n int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM msg WHERE conv_id = ?", conv.ID).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("%d messages of the deleted conv remain", n)
+	}
+}
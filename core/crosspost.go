@@ -0,0 +1,130 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/images"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// CrosspostSource is what's shown of the original post of a crosspost.
+type CrosspostSource struct {
+	ID            uid.ID        `json:"id"`
+	PublicID      string        `json:"publicId,omitempty"`
+	Type          PostType      `json:"type"`
+	CommunityID   uid.ID        `json:"communityId"`
+	CommunityName string        `json:"communityName"`
+	Title         string        `json:"title"`
+	Link          *PostLink     `json:"link,omitempty"`
+	Image         *images.Image `json:"image"`
+
+	// If the original post is deleted, only ID and Deleted are set.
+	Deleted bool `json:"deleted"`
+}
+
+func newCrosspostSource(post *Post) *CrosspostSource {
+	if post.Deleted {
+		return &CrosspostSource{ID: post.ID, Deleted: true}
+	}
+	return &CrosspostSource{
+		ID:            post.ID,
+		PublicID:      post.PublicID,
+		Type:          post.Type,
+		CommunityID:   post.CommunityID,
+		CommunityName: post.CommunityName,
+		Title:         post.Title,
+		Link:          post.Link,
+		Image:         post.Image,
+	}
+}
+
+// CreateCrosspost creates a post in community that references the post
+// original. If original is itself a crosspost, the new post references the
+// post that original references.
+func CreateCrosspost(ctx context.Context, db *sql.DB, author, community uid.ID, title string, original uid.ID, flair uint) (*Post, error) {
+	orig, err := GetPost(ctx, db, &original, "", nil, false)
+	if err != nil {
+		return nil, err
+	}
+	if orig.crosspostOf.Valid {
+		if orig, err = GetPost(ctx, db, &orig.crosspostOf.ID, "", nil, false); err != nil {
+			return nil, err
+		}
+	}
+
+	if orig.CommunityID.EqualsTo(community) {
+		return nil, httperr.NewBadRequest("crosspost/same-community", "Cannot crosspost a post to its own community.")
+	}
+
+	var n int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM posts WHERE crosspost_of = ? AND community_id = ? AND deleted = FALSE", orig.ID, community).Scan(&n); err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return nil, &httperr.Error{
+			HTTPStatus: http.StatusConflict,
+			Code:       "crosspost/already-crossposted",
+			Message:    "Post is already crossposted to the community.",
+		}
+	}
+
+	// A crosspost of an NSFW post, or of a post in an NSFW community, is NSFW.
+	nsfw := orig.NSFW
+	if !nsfw {
+		if err := db.QueryRowContext(ctx, "SELECT nsfw FROM communities WHERE id = ?", orig.CommunityID).Scan(&nsfw); err != nil {
+			return nil, err
+		}
+	}
+
+	if title == "" {
+		title = orig.Title
+	}
+	return createPost(ctx, db, &createPostOpts{
+		postType:    PostTypeCrosspost,
+		author:      author,
+		community:   community,
+		title:       title,
+		crosspostOf: orig.ID,
+		nsfw:        nsfw,
+		flair:       flair,
+	})
+}
+
+// populatePostsCrossposts sets the Crosspost field of the posts that are
+// crossposts.
+func populatePostsCrossposts(ctx context.Context, db *sql.DB, posts []*Post, viewer *uid.ID) error {
+	var ids []uid.ID
+	added := make(map[uid.ID]bool)
+	for _, post := range posts {
+		if post.crosspostOf.Valid && !added[post.crosspostOf.ID] {
+			ids = append(ids, post.crosspostOf.ID)
+			added[post.crosspostOf.ID] = true
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	originals, err := GetPostsByIDs(ctx, db, viewer, true, ids...)
+	if err != nil && err != errPostNotFound {
+		return err
+	}
+	byID := make(map[uid.ID]*Post, len(originals))
+	for _, orig := range originals {
+		byID[orig.ID] = orig
+	}
+	for _, post := range posts {
+		if !post.crosspostOf.Valid {
+			continue
+		}
+		if orig, ok := byID[post.crosspostOf.ID]; ok {
+			post.Crosspost = newCrosspostSource(orig)
+		} else {
+			post.Crosspost = &CrosspostSource{ID: post.crosspostOf.ID, Deleted: true}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+func TestNewCrosspostSource(t *testing.T) {
+	post := &Post{
+		ID:            uid.New(),
+		PublicID:      "abc",
+		Type:          PostTypeLink,
+		CommunityName: "general",
+		Title:         "Original",
+		Link:          &PostLink{URL: "https://example.com"},
+	}
+
+	src := newCrosspostSource(post)
+	if src.Deleted || src.Title != post.Title || src.Link != post.Link || src.CommunityName != post.CommunityName {
+		t.Errorf("newCrosspostSource(undeleted post) = %+v", src)
+	}
+
+	post.Deleted = true
+	src = newCrosspostSource(post)
+	want := CrosspostSource{ID: post.ID, Deleted: true}
+	if *src != want {
+		t.Errorf("newCrosspostSource(deleted post) = %+v, want %+v", src, want)
+	}
+}
@@ -0,0 +1,332 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/discuitnet/discuit/internal/utils"
+)
+
+// maxCustomFeedCommunities is the maximum number of communities a custom feed
+// can have.
+const maxCustomFeedCommunities = 100
+
+var (
+	errCustomFeedNotFound = httperr.NewNotFound("custom-feed-not-found", "Custom feed not found.")
+	errCustomFeedFull     = httperr.NewForbidden("custom-feed-full", fmt.Sprintf("A feed can have at most %d communities.", maxCustomFeedCommunities))
+)
+
+// CustomFeed is a named, user-defined feed made of an arbitrary set of
+// communities. Its posts are fetched with GetFeed by setting
+// FeedOptions.CustomFeed.
+type CustomFeed struct {
+	ID             int             `json:"id"`
+	UserID         uid.ID          `json:"userId"`
+	Username       string          `json:"username"`
+	Name           string          `json:"name"`
+	DisplayName    string          `json:"displayName"`
+	Description    msql.NullString `json:"description"`
+	Public         bool            `json:"public"`
+	NumCommunities int             `json:"numCommunities"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	LastUpdatedAt  time.Time       `json:"lastUpdatedAt"`
+}
+
+func getCustomFeeds(ctx context.Context, db *sql.DB, where string, args ...any) ([]*CustomFeed, error) {
+	query := msql.BuildSelectQuery("custom_feeds", []string{
+		"custom_feeds.id",
+		"custom_feeds.user_id",
+		"users.username",
+		"custom_feeds.name",
+		"custom_feeds.display_name",
+		"custom_feeds.description",
+		"custom_feeds.public",
+		"custom_feeds.num_communities",
+		"custom_feeds.created_at",
+		"custom_feeds.last_updated_at",
+	}, []string{
+		"INNER JOIN users ON custom_feeds.user_id = users.id",
+	}, where)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	feeds := []*CustomFeed{}
+	for rows.Next() {
+		feed := &CustomFeed{}
+		err = rows.Scan(
+			&feed.ID,
+			&feed.UserID,
+			&feed.Username,
+			&feed.Name,
+			&feed.DisplayName,
+			&feed.Description,
+			&feed.Public,
+			&feed.NumCommunities,
+			&feed.CreatedAt,
+			&feed.LastUpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, feed)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return feeds, nil
+}
+
+func GetCustomFeed(ctx context.Context, db *sql.DB, id int) (*CustomFeed, error) {
+	feeds, err := getCustomFeeds(ctx, db, "WHERE custom_feeds.id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(feeds) == 0 {
+		return nil, errCustomFeedNotFound
+	}
+	return feeds[0], nil
+}
+
+func GetCustomFeedByName(ctx context.Context, db *sql.DB, user uid.ID, name string) (*CustomFeed, error) {
+	feeds, err := getCustomFeeds(ctx, db, "WHERE custom_feeds.user_id = ? AND custom_feeds.name = ?", user, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(feeds) == 0 {
+		return nil, errCustomFeedNotFound
+	}
+	return feeds[0], nil
+}
+
+// GetUsersCustomFeeds returns all the custom feeds of user, sorted by name. If
+// publicOnly is true, private feeds are excluded.
+func GetUsersCustomFeeds(ctx context.Context, db *sql.DB, user uid.ID, publicOnly bool) ([]*CustomFeed, error) {
+	where := "WHERE custom_feeds.user_id = ? "
+	if publicOnly {
+		where += "AND custom_feeds.public = TRUE "
+	}
+	return getCustomFeeds(ctx, db, where+"ORDER BY custom_feeds.name ASC", user)
+}
+
+// customFeedNameValid always returns an httperr.Error.
+func customFeedNameValid(name string) error {
+	if err := IsUsernameValid(name); err != nil {
+		return httperr.NewBadRequest("invalid-custom-feed-name", fmt.Sprintf("feed name %v", err))
+	}
+	return nil
+}
+
+// CreateCustomFeed creates a new custom feed of user made of communities. Either
+// the feed is created with all of communities or it's not created at all.
+func CreateCustomFeed(ctx context.Context, db *sql.DB, user uid.ID, name, displayName string, description msql.NullString, public bool, communities []uid.ID) (*CustomFeed, error) {
+	if description.String == "" {
+		description.Valid = false
+	}
+
+	if err := customFeedNameValid(name); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[uid.ID]bool, len(communities))
+	var ids []uid.ID
+	for _, id := range communities {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > maxCustomFeedCommunities {
+		return nil, errCustomFeedFull
+	}
+
+	displayName = utils.TruncateUnicodeString(displayName, 50)
+	description.String = utils.TruncateUnicodeString(description.String, maxUserProfileAboutLength)
+
+	query, args := msql.BuildInsertQuery("custom_feeds", []msql.ColumnValue{
+		{Name: "user_id", Value: user},
+		{Name: "name", Value: name},
+		{Name: "display_name", Value: displayName},
+		{Name: "description", Value: description},
+		{Name: "public", Value: public},
+	})
+	var id int64
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		if id, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		commArgs := make([]any, len(ids))
+		for i := range ids {
+			commArgs[i] = ids[i]
+		}
+		var count int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM communities WHERE id IN "+msql.InClauseQuestionMarks(len(ids)), commArgs...).Scan(&count); err != nil {
+			return err
+		}
+		if count != len(ids) {
+			return errCommunityNotFound
+		}
+		for _, community := range ids {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO custom_feed_communities (feed_id, community_id) VALUES (?, ?)", id, community); err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE custom_feeds SET num_communities = ? WHERE id = ?", len(ids), id)
+		return err
+	})
+	if msql.IsErrDuplicateErr(err) {
+		return nil, &httperr.Error{
+			HTTPStatus: http.StatusConflict,
+			Code:       "duplicate-custom-feed",
+			Message:    "A feed with that name already exists.",
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return GetCustomFeed(ctx, db, int(id))
+}
+
+// Update updates the feed's updatable fields.
+func (f *CustomFeed) Update(ctx context.Context, db *sql.DB) error {
+	if err := customFeedNameValid(f.Name); err != nil {
+		return err
+	}
+
+	f.Description.String = utils.TruncateUnicodeString(f.Description.String, maxUserProfileAboutLength)
+	f.DisplayName = utils.TruncateUnicodeString(f.DisplayName, 50)
+
+	_, err := db.ExecContext(ctx, `
+		UPDATE custom_feeds SET
+			name = ?,
+			display_name = ?,
+			description = ?,
+			public = ?,
+			last_updated_at = now()
+		WHERE custom_feeds.id = ?`,
+		f.Name,
+		f.DisplayName,
+		f.Description,
+		f.Public,
+		f.ID)
+	if err != nil && msql.IsErrDuplicateErr(err) {
+		return &httperr.Error{
+			HTTPStatus: http.StatusConflict,
+			Code:       "duplicate-custom-feed",
+			Message:    "A feed with that name already exists.",
+		}
+	}
+	return err
+}
+
+// UnmarshalUpdatableFieldsJSON extracts the updatable values of the feed from
+// the encoded JSON string.
+func (f *CustomFeed) UnmarshalUpdatableFieldsJSON(data []byte) error {
+	temp := *f // shallow copy
+	if err := json.Unmarshal(data, &temp); err != nil {
+		return err
+	}
+	f.Name = temp.Name
+	f.DisplayName = temp.DisplayName
+	f.Description = temp.Description
+	if f.Description.String == "" {
+		f.Description.Valid = false
+	}
+	f.Public = temp.Public
+	return nil
+}
+
+func (f *CustomFeed) Delete(ctx context.Context, db *sql.DB) error {
+	// The rows of custom_feed_communities are deleted by ON DELETE CASCADE.
+	_, err := db.ExecContext(ctx, "DELETE FROM custom_feeds WHERE id = ?", f.ID)
+	return err
+}
+
+// Communities returns the communities of the feed, sorted by name.
+func (f *CustomFeed) Communities(ctx context.Context, db *sql.DB, viewer *uid.ID) ([]*Community, error) {
+	rows, err := db.QueryContext(ctx, "SELECT community_id FROM custom_feed_communities WHERE feed_id = ?", f.ID)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := scanIDs(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []*Community{}, nil
+	}
+
+	args := make([]any, len(ids))
+	for i := range ids {
+		args[i] = ids[i]
+	}
+	where := fmt.Sprintf("WHERE communities.id IN %s AND communities.deleted_at IS NULL ORDER BY communities.name_lc", msql.InClauseQuestionMarks(len(ids)))
+	return getCommunities(ctx, db, viewer, where, args...)
+}
+
+// AddCommunity adds community to the feed. Adding a community that's already
+// in the feed is a no-op.
+func (f *CustomFeed) AddCommunity(ctx context.Context, db *sql.DB, community uid.ID) error {
+	if _, err := GetCommunityByID(ctx, db, community, nil); err != nil {
+		return err
+	}
+	return msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		var count int
+		if err := tx.QueryRowContext(ctx, "SELECT num_communities FROM custom_feeds WHERE id = ? FOR UPDATE", f.ID).Scan(&count); err != nil {
+			return err
+		}
+		if count >= maxCustomFeedCommunities {
+			return errCustomFeedFull
+		}
+		res, err := tx.ExecContext(ctx, "INSERT IGNORE INTO custom_feed_communities (feed_id, community_id) VALUES (?, ?)", f.ID, community)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE custom_feeds SET num_communities = num_communities + 1, last_updated_at = now() WHERE id = ?", f.ID); err != nil {
+			return err
+		}
+		f.NumCommunities = count + 1
+		return nil
+	})
+}
+
+// RemoveCommunity removes community from the feed.
+func (f *CustomFeed) RemoveCommunity(ctx context.Context, db *sql.DB, community uid.ID) error {
+	return msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "DELETE FROM custom_feed_communities WHERE feed_id = ? AND community_id = ?", f.ID, community)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE custom_feeds SET num_communities = num_communities - 1, last_updated_at = now() WHERE id = ?", f.ID); err != nil {
+			return err
+		}
+		f.NumCommunities--
+		return nil
+	})
+}
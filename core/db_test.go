@@ -0,0 +1,37 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/discuitnet/discuit/internal/uid"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// openTestDB returns a connection to the database at the DSN in the
+// DISCUIT_TEST_DSN environment variable, which should have all migrations
+// applied. The test is skipped if the variable is not set.
+func openTestDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("DISCUIT_TEST_DSN")
+	if dsn == "" {
+		t.Skip("DISCUIT_TEST_DSN is not set")
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newTestUser registers a user with a random username.
+func newTestUser(t *testing.T, db *sql.DB) *User {
+	id := uid.New().String()
+	user, err := RegisterUser(context.Background(), db, "t_"+id[len(id)-12:], "", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
@@ -12,6 +12,10 @@ var (
 	ErrWrongPassword = &httperr.Error{HTTPStatus: http.StatusUnauthorized, Code: "wrong-password", Message: "Username and password do not match."}
 
 	ErrUserDeleted = httperr.NewForbidden("user-deleted", "Cannot continue because the user is deleted.")
+
+	// ErrMessageExists is returned by Convs.SendMessage if the sender already
+	// has a message in the conv with the same client ID.
+	ErrMessageExists = &httperr.Error{HTTPStatus: http.StatusConflict, Code: "duplicate-row", Message: "This message already exists."}
 )
 
 var (
@@ -26,6 +26,9 @@ const (
 	FeedSortTopMonth
 	FeedSortTopYear
 	FeedSortTopAll
+	FeedSortRising        // Vote velocity of recent posts (see PostRising).
+	FeedSortControversial // See PostControversy.
+	FeedSortBest          // See PostBestScore.
 )
 
 // Valid reports whether f is a valid FeedSort.
@@ -53,6 +56,12 @@ func (s FeedSort) MarshalText() ([]byte, error) {
 		return []byte("hot"), nil
 	case FeedSortActivity:
 		return []byte("activity"), nil
+	case FeedSortRising:
+		return []byte("rising"), nil
+	case FeedSortControversial:
+		return []byte("controversial"), nil
+	case FeedSortBest:
+		return []byte("best"), nil
 	}
 	return nil, fmt.Errorf("cannot marshal unsupported FeedSort (%v)", int(s))
 }
@@ -81,6 +90,12 @@ func (s *FeedSort) UnmarshalText(text []byte) error {
 		*s = FeedSortHot
 	case "activity":
 		*s = FeedSortActivity
+	case "rising":
+		*s = FeedSortRising
+	case "controversial":
+		*s = FeedSortControversial
+	case "best":
+		*s = FeedSortBest
 	default:
 		return fmt.Errorf("cannot unmarshal unsupported FeedSort: %v", t)
 	}
@@ -149,6 +164,9 @@ func newFeedResultSet(posts []*Post, limit int, sort FeedSort) *FeedResultSet {
 			nextnext = strconv.Itoa(posts[limit].Hotness) + "." + posts[limit].ID.String()
 		case FeedSortActivity:
 			nextnext = posts[limit].LastActivityAt.UnixNano()
+		case FeedSortRising, FeedSortControversial, FeedSortBest:
+			col := scoreFeedSorts[sort]
+			nextnext = col.cursorPrefix + strconv.Itoa(col.score(posts[limit])) + "." + posts[limit].ID.String()
 		default:
 			// Shouldn't happen, ever.
 			panic("invalid feed sort")
@@ -177,16 +195,82 @@ func NextPointsIDCursor(text string) (p int, id *uid.ID, err error) {
 	return
 }
 
+// NextScoreIDCursor parses a cursor of the rising, controversial, and best
+// feeds, which is of the form <prefix><score>.<id>, where prefix identifies the
+// feed sort.
+func NextScoreIDCursor(text, prefix string) (score int, id *uid.ID, err error) {
+	if !strings.HasPrefix(text, prefix) {
+		err = errors.New("invalid cursor prefix")
+		return
+	}
+	return NextPointsIDCursor(text[len(prefix):])
+}
+
 const whereSelectUserComms = "community_id IN (SELECT community_members.community_id FROM community_members WHERE community_members.user_id = ?) "
 
+const whereSelectCustomFeedComms = "community_id IN (SELECT custom_feed_communities.community_id FROM custom_feed_communities WHERE custom_feed_communities.feed_id = ?) "
+
 type FeedOptions struct {
 	Sort        FeedSort
 	DefaultSort bool
 	Viewer      *uid.ID
-	Community   *uid.ID // Community should be nil if Homefeed is true.
+	Community   *uid.ID // Community should be nil if Homefeed is true or if CustomFeed is set.
 	Homefeed    bool
+	CustomFeed  *int // The ID of a custom feed (see CustomFeed).
 	Limit       int
 	Next        string // The pagination cursor, taken from previous API response.
+
+	// If set, only posts created on or after From, and before To, are
+	// included. With a date range, the top sorts (day, week, etc) are all the
+	// same.
+	From, To *time.Time
+
+	// If non-zero, only posts with this flair are included. It's ignored
+	// unless Community is set.
+	Flair uint
+
+	// If true, posts that Viewer has already viewed are excluded. It's ignored
+	// unless Homefeed is true. (Posts hidden by Viewer are always excluded.)
+	HideViewed bool
+
+	hideNSFW bool // Set by GetFeed as per the NSFW preference of Viewer.
+}
+
+// whereFeedOptions adds the conditions of the date range of o, of the flair
+// filter, and of hiding NSFW, hidden, and viewed posts, to where. The argument
+// postID is the column that holds the id of the post (ids of posts are ordered
+// by their creation time).
+func (o *FeedOptions) whereFeedOptions(where, postID string, args []any) (string, []any) {
+	and := func(cond string) {
+		if !(where == "" || strings.TrimSpace(strings.ToUpper(where)) == "WHERE") {
+			where += "AND "
+		}
+		where += cond
+	}
+	if o.From != nil {
+		and(postID + " >= ? ")
+		args = append(args, uid.From(uint64(o.From.UnixNano()), 0))
+	}
+	if o.To != nil {
+		and(postID + " < ? ")
+		args = append(args, uid.From(uint64(o.To.UnixNano()), 0))
+	}
+	if o.Flair != 0 {
+		and(postID + " IN (SELECT id FROM posts WHERE flair_id = ?) ")
+		args = append(args, o.Flair)
+	}
+	if o.hideNSFW {
+		and(nsfwPostsClause(postID) + " ")
+	}
+	if o.Viewer != nil {
+		and(hiddenPostsClause(postID) + " ")
+		args = append(args, *o.Viewer)
+		if o.HideViewed {
+			and(viewedPostsClause(postID) + " ")
+			args = append(args, *o.Viewer)
+		}
+	}
+	return where, args
 }
 
 var (
@@ -229,6 +313,18 @@ func GetFeed(ctx context.Context, db *sql.DB, opts *FeedOptions) (_ *FeedResultS
 	if !opts.Sort.Valid() {
 		return nil, ErrInvalidFeedSort
 	}
+	pref, err := GetNSFWPreference(ctx, db, opts.Viewer)
+	if err != nil {
+		return nil, err
+	}
+	opts.hideNSFW = pref == NSFWPreferenceHide
+	if opts.Community == nil {
+		opts.Flair = 0 // Flair filters are only for community feeds.
+	}
+	if !opts.Homefeed || opts.Viewer == nil {
+		opts.HideViewed = false
+	}
+
 	var set *FeedResultSet
 	if opts.Sort == FeedSortLatest {
 		set, err = getPostsLatest(ctx, db, opts)
@@ -236,14 +332,16 @@ func GetFeed(ctx context.Context, db *sql.DB, opts *FeedOptions) (_ *FeedResultS
 		set, err = getPostsHot(ctx, db, opts)
 	} else if opts.Sort == FeedSortActivity {
 		set, err = getPostsActivity(ctx, db, opts)
+	} else if _, ok := scoreFeedSorts[opts.Sort]; ok {
+		set, err = getPostsByScore(ctx, db, opts)
 	} else {
 		set, err = getPostsTop(ctx, db, opts)
 	}
 	if err != nil {
 		return nil, err
 	}
-	if opts.DefaultSort {
-		// Merge pinned posts.
+	if opts.DefaultSort && opts.Flair == 0 {
+		// Merge pinned posts (they're not merged into flair-filtered feeds).
 		return mergePinnedPosts(ctx, db, opts.Viewer, opts.Community, opts.Next, set)
 	}
 	return set, err
@@ -262,6 +360,9 @@ func getPostsLatest(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedRe
 	if opts.Homefeed {
 		where += "AND " + whereSelectUserComms
 		args = append(args, *opts.Viewer)
+	} else if opts.CustomFeed != nil {
+		where += "AND " + whereSelectCustomFeedComms
+		args = append(args, *opts.CustomFeed)
 	} else {
 		if opts.Community != nil {
 			where += "AND community_id = ? "
@@ -270,7 +371,9 @@ func getPostsLatest(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedRe
 	}
 	if loggedIn {
 		where, args = whereMuted(where, "posts", args, *opts.Viewer, opts.Community == nil && !opts.Homefeed)
+		where, args = whereFiltered(where, "posts.id", args, *opts.Viewer)
 	}
+	where, args = opts.whereFeedOptions(where, "posts.id", args)
 	if opts.Next != "" {
 		next, err := opts.nextID()
 		if err != nil {
@@ -374,11 +477,18 @@ func whereMuted(where, postsTable string, args []any, viewer uid.ID, muteCommuni
 }
 
 // getPostsHot returns site wide hot posts, if opts.Community is nil, or hot
-// posts in opts.Community, if not.
+// posts in opts.Community, if not. If normalizeAllFeed is true, the site wide
+// hot posts are sorted by their normalized hotness.
 func getPostsHot(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResultSet, error) {
 	var args []any
 	loggedIn := opts.Viewer != nil
 
+	column := "hotness"
+	normalized := normalizeAllFeed && opts.Community == nil && !opts.Homefeed && opts.CustomFeed == nil
+	if normalized {
+		column = "normalized_hotness"
+	}
+
 	if loggedIn {
 		args = append(args, opts.Viewer)
 	}
@@ -386,6 +496,9 @@ func getPostsHot(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResul
 	if opts.Homefeed {
 		where += "AND " + whereSelectUserComms
 		args = append(args, *opts.Viewer)
+	} else if opts.CustomFeed != nil {
+		where += "AND " + whereSelectCustomFeedComms
+		args = append(args, *opts.CustomFeed)
 	} else {
 		if opts.Community != nil {
 			where += "AND community_id = ? "
@@ -394,17 +507,19 @@ func getPostsHot(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResul
 	}
 	if loggedIn {
 		where, args = whereMuted(where, "posts", args, *opts.Viewer, opts.Community == nil && !opts.Homefeed)
+		where, args = whereFiltered(where, "posts.id", args, *opts.Viewer)
 	}
+	where, args = opts.whereFeedOptions(where, "posts.id", args)
 	if opts.Next != "" {
 		nextHotness, nextID, err := opts.nextPointsID()
 		if err != nil {
 			return nil, err
 		}
-		where += "AND (posts.hotness, posts.id) <= (?, ?) "
+		where += "AND (posts." + column + ", posts.id) <= (?, ?) "
 		args = append(args, nextHotness)
 		args = append(args, nextID)
 	}
-	where += "ORDER BY posts.hotness DESC, posts.id DESC LIMIT ?"
+	where += "ORDER BY posts." + column + " DESC, posts.id DESC LIMIT ?"
 	query := buildSelectPostQuery(loggedIn, where)
 
 	var rows *sql.Rows
@@ -422,7 +537,86 @@ func getPostsHot(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResul
 		}
 		return nil, err
 	}
-	return newFeedResultSet(posts, opts.Limit, FeedSortHot), nil
+	set := newFeedResultSet(posts, opts.Limit, FeedSortHot)
+	if normalized && set.Next != nil {
+		last := posts[opts.Limit]
+		set.Next = strconv.Itoa(last.NormHotness) + "." + last.ID.String()
+	}
+	return set, nil
+}
+
+// scoreFeedSort describes a feed sort that's backed by a score column of the
+// posts table.
+type scoreFeedSort struct {
+	column       string
+	cursorPrefix string
+	score        func(*Post) int
+}
+
+var scoreFeedSorts = map[FeedSort]scoreFeedSort{
+	FeedSortRising:        {"rising", "r", func(p *Post) int { return p.Rising }},
+	FeedSortControversial: {"controversy", "c", func(p *Post) int { return p.Controversy }},
+	FeedSortBest:          {"best", "b", func(p *Post) int { return p.Best }},
+}
+
+// getPostsByScore returns site wide posts, if opts.Community is nil, or posts in
+// opts.Community, if not, sorted by one of the score columns in scoreFeedSorts.
+func getPostsByScore(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResultSet, error) {
+	sort := scoreFeedSorts[opts.Sort]
+	column := "posts." + sort.column
+
+	var args []any
+	loggedIn := opts.Viewer != nil
+
+	if loggedIn {
+		args = append(args, opts.Viewer)
+	}
+	where := "WHERE posts.deleted = FALSE "
+	if opts.Sort == FeedSortRising {
+		where += "AND posts.rising > 0 "
+	}
+	if opts.Homefeed {
+		where += "AND " + whereSelectUserComms
+		args = append(args, *opts.Viewer)
+	} else if opts.CustomFeed != nil {
+		where += "AND " + whereSelectCustomFeedComms
+		args = append(args, *opts.CustomFeed)
+	} else {
+		if opts.Community != nil {
+			where += "AND community_id = ? "
+			args = append(args, *opts.Community)
+		}
+	}
+	if loggedIn {
+		where, args = whereMuted(where, "posts", args, *opts.Viewer, opts.Community == nil && !opts.Homefeed)
+		where, args = whereFiltered(where, "posts.id", args, *opts.Viewer)
+	}
+	where, args = opts.whereFeedOptions(where, "posts.id", args)
+	if opts.Next != "" {
+		nextScore, nextID, err := NextScoreIDCursor(opts.Next, sort.cursorPrefix)
+		if err != nil || nextID == nil {
+			return nil, ErrInvalidFeedCursor
+		}
+		where += fmt.Sprintf("AND (%s, posts.id) <= (?, ?) ", column)
+		args = append(args, nextScore, *nextID)
+	}
+	where += fmt.Sprintf("ORDER BY %s DESC, posts.id DESC LIMIT ?", column)
+	query := buildSelectPostQuery(loggedIn, where)
+
+	args = append(args, opts.Limit+1)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, err := scanPosts(ctx, db, rows, opts.Viewer)
+	if err != nil {
+		if err == errPostNotFound {
+			return &FeedResultSet{}, nil
+		}
+		return nil, err
+	}
+	return newFeedResultSet(posts, opts.Limit, opts.Sort), nil
 }
 
 // getPostsTopAll returns site wide all time top posts, if opts.Community is
@@ -438,6 +632,9 @@ func getPostsTopAll(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedRe
 	if opts.Homefeed {
 		where += "AND " + whereSelectUserComms
 		args = append(args, *opts.Viewer)
+	} else if opts.CustomFeed != nil {
+		where += "AND " + whereSelectCustomFeedComms
+		args = append(args, *opts.CustomFeed)
 	} else {
 		if opts.Community != nil {
 			where += "AND community_id = ? "
@@ -446,7 +643,9 @@ func getPostsTopAll(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedRe
 	}
 	if loggedIn {
 		where, args = whereMuted(where, "posts", args, *opts.Viewer, opts.Community == nil && !opts.Homefeed)
+		where, args = whereFiltered(where, "posts.id", args, *opts.Viewer)
 	}
+	where, args = opts.whereFeedOptions(where, "posts.id", args)
 	if opts.Next != "" {
 		nextPoints, nextID, err := opts.nextPointsID()
 		if err != nil {
@@ -477,9 +676,10 @@ func getPostsTopAll(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedRe
 
 // getPostsTop returns site wide top posts (daily, weekly, etc), if
 // opts.Community is nil, or top posts (daily, weekly, etc) in opts.Community,
-// if not.
+// if not. If opts has a date range, top posts within the range are returned
+// instead.
 func getPostsTop(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResultSet, error) {
-	if opts.Sort == FeedSortTopAll {
+	if opts.Sort == FeedSortTopAll || opts.From != nil || opts.To != nil {
 		return getPostsTopAll(ctx, db, opts)
 	}
 	table := sortFeedToTable(opts.Sort)
@@ -490,6 +690,9 @@ func getPostsTop(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResul
 	if opts.Homefeed {
 		where += whereSelectUserComms
 		args = append(args, *opts.Viewer)
+	} else if opts.CustomFeed != nil {
+		where += whereSelectCustomFeedComms
+		args = append(args, *opts.CustomFeed)
 	} else {
 		if opts.Community != nil {
 			where += "community_id = ? "
@@ -498,7 +701,9 @@ func getPostsTop(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResul
 	}
 	if opts.Viewer != nil {
 		where, args = whereMuted(where, table, args, *opts.Viewer, opts.Community == nil && !opts.Homefeed)
+		where, args = whereFiltered(where, table+".post_id", args, *opts.Viewer)
 	}
+	where, args = opts.whereFeedOptions(where, table+".post_id", args)
 	if opts.Next != "" {
 		nextPoints, nextID, err := opts.nextPointsID()
 		if err != nil {
@@ -551,6 +756,9 @@ func getPostsActivity(ctx context.Context, db *sql.DB, opts *FeedOptions) (*Feed
 	if opts.Homefeed {
 		where += "AND " + whereSelectUserComms
 		args = append(args, *opts.Viewer)
+	} else if opts.CustomFeed != nil {
+		where += "AND " + whereSelectCustomFeedComms
+		args = append(args, *opts.CustomFeed)
 	} else {
 		if opts.Community != nil {
 			where += "AND community_id = ? "
@@ -559,7 +767,9 @@ func getPostsActivity(ctx context.Context, db *sql.DB, opts *FeedOptions) (*Feed
 	}
 	if loggedIn {
 		where, args = whereMuted(where, "posts", args, *opts.Viewer, opts.Community == nil && !opts.Homefeed)
+		where, args = whereFiltered(where, "posts.id", args, *opts.Viewer)
 	}
+	where, args = opts.whereFeedOptions(where, "posts.id", args)
 	if opts.Next != "" {
 		next, err := opts.nextInt64()
 		if err != nil {
@@ -696,6 +906,19 @@ func GetUserFeed(ctx context.Context, db *sql.DB, viewer *uid.ID, userID uid.ID,
 		query += "AND deleted = false "
 	}
 
+	if viewer != nil {
+		// Hide the posts that match the viewer's filter mutes.
+		query += "AND (target_type <> ? OR " + mutedFiltersClause("posts_comments.target_id") + ") "
+		args = append(args, ContentTypePost, *viewer)
+
+		if pref, err := GetNSFWPreference(ctx, db, viewer); err != nil {
+			return nil, err
+		} else if pref == NSFWPreferenceHide {
+			query += "AND (target_type <> ? OR " + nsfwPostsClause("posts_comments.target_id") + ") "
+			args = append(args, ContentTypePost)
+		}
+	}
+
 	if next != nil {
 		query += "AND target_id <= ? "
 		args = append(args, *next)
@@ -0,0 +1,37 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+func TestWhereFeedOptions(t *testing.T) {
+	viewer, community := uid.New(), uid.New()
+	from, to := time.Now().Add(-time.Hour), time.Now()
+
+	tests := []struct {
+		name  string
+		opts  FeedOptions
+		conds []string
+	}{
+		{"empty", FeedOptions{}, nil},
+		{"date range", FeedOptions{From: &from, To: &to}, []string{"posts.id >= ?", "posts.id < ?"}},
+		{"flair", FeedOptions{Community: &community, Flair: 3}, []string{"flair_id = ?"}},
+		{"hidden", FeedOptions{Viewer: &viewer}, []string{"hidden_posts"}},
+		{"hidden and viewed", FeedOptions{Viewer: &viewer, Homefeed: true, HideViewed: true}, []string{"hidden_posts", "post_views"}},
+	}
+	for _, test := range tests {
+		where, args := test.opts.whereFeedOptions("WHERE posts.deleted = ? ", "posts.id", []any{false})
+		for _, cond := range test.conds {
+			if !strings.Contains(where, cond) {
+				t.Errorf("%s: where %q does not contain %q", test.name, where, cond)
+			}
+		}
+		if n := strings.Count(where, "?"); n != len(args) {
+			t.Errorf("%s: where %q has %d placeholders but there are %d args", test.name, where, n, len(args))
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/discuitnet/discuit/internal/utils"
+)
+
+const (
+	maxFlairTextLength    = 64
+	maxFlairsPerCommunity = 50
+)
+
+var flairColorRegexp = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// CommunityFlair is a label, defined by the moderators of a community, that
+// can be attached to the posts of the community.
+type CommunityFlair struct {
+	db *sql.DB
+
+	ID          uint      `json:"id"`
+	CommunityID uid.ID    `json:"communityId"`
+	Text        string    `json:"text"`
+	Color       string    `json:"color"` // A hex color (#rrggbb).
+	CreatedBy   uid.ID    `json:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+var selectCommunityFlairCols = []string{
+	"id",
+	"community_id",
+	"text",
+	"color",
+	"created_by",
+	"created_at",
+}
+
+// validate trims f.Text and checks f.Text and f.Color. It always returns an
+// httperr.Error on error.
+func (f *CommunityFlair) validate() error {
+	f.Text = utils.TruncateUnicodeString(strings.TrimSpace(f.Text), maxFlairTextLength)
+	if f.Text == "" {
+		return httperr.NewBadRequest("flair/empty-text", "Flair text cannot be empty.")
+	}
+	if !flairColorRegexp.MatchString(f.Color) {
+		return httperr.NewBadRequest("flair/invalid-color", "Flair color must be a hex color (#rrggbb).")
+	}
+	f.Color = strings.ToLower(f.Color)
+	return nil
+}
+
+// GetCommunityFlair returns a not-found httperr.Error if no flair is found.
+func GetCommunityFlair(ctx context.Context, db *sql.DB, flairID uint) (*CommunityFlair, error) {
+	flairs, err := getCommunityFlairs(ctx, db, "WHERE id = ?", flairID)
+	if err != nil {
+		return nil, err
+	}
+	if len(flairs) == 0 {
+		return nil, httperr.NewNotFound("flair-not-found", "Flair not found.")
+	}
+	return flairs[0], nil
+}
+
+func getCommunityFlairs(ctx context.Context, db *sql.DB, where string, args ...any) ([]*CommunityFlair, error) {
+	query := msql.BuildSelectQuery("community_flairs", selectCommunityFlairCols, nil, where)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flairs []*CommunityFlair
+	for rows.Next() {
+		f := &CommunityFlair{db: db}
+		if err := rows.Scan(&f.ID, &f.CommunityID, &f.Text, &f.Color, &f.CreatedBy, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		flairs = append(flairs, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return flairs, nil
+}
+
+// FetchFlairs populates c.Flairs.
+func (c *Community) FetchFlairs(ctx context.Context) error {
+	flairs, err := getCommunityFlairs(ctx, c.db, "WHERE community_id = ? ORDER BY id", c.ID)
+	if err != nil {
+		return err
+	}
+	c.Flairs = flairs
+	if c.Flairs == nil {
+		c.Flairs = make([]*CommunityFlair, 0)
+	}
+	return nil
+}
+
+// AddFlair creates a new flair in c. Only moderators and admins can add flairs.
+func (c *Community) AddFlair(ctx context.Context, text, color string, mod uid.ID) (*CommunityFlair, error) {
+	if is, err := c.UserModOrAdmin(ctx, mod); err != nil {
+		return nil, err
+	} else if !is {
+		return nil, errNotMod
+	}
+
+	f := &CommunityFlair{Text: text, Color: color}
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+
+	var n int
+	if err := c.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM community_flairs WHERE community_id = ?", c.ID).Scan(&n); err != nil {
+		return nil, err
+	}
+	if n >= maxFlairsPerCommunity {
+		return nil, httperr.NewForbidden("flair/max-reached", "Maximum number of flairs reached.")
+	}
+
+	res, err := c.db.ExecContext(ctx, "INSERT INTO community_flairs (community_id, text, color, created_by) VALUES (?, ?, ?, ?)", c.ID, f.Text, f.Color, mod)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return GetCommunityFlair(ctx, c.db, uint(id))
+}
+
+// SetFlairRequired sets whether posts submitted to c must have a flair.
+func (c *Community) SetFlairRequired(ctx context.Context, mod uid.ID, required bool) error {
+	if is, err := c.UserModOrAdmin(ctx, mod); err != nil {
+		return err
+	} else if !is {
+		return errNotMod
+	}
+	if _, err := c.db.ExecContext(ctx, "UPDATE communities SET flair_required = ? WHERE id = ?", required, c.ID); err != nil {
+		return err
+	}
+	c.FlairRequired = required
+	return nil
+}
+
+// Update updates the text and color of the flair.
+func (f *CommunityFlair) Update(ctx context.Context, mod uid.ID) error {
+	if is, err := UserModOrAdmin(ctx, f.db, f.CommunityID, mod); err != nil {
+		return err
+	} else if !is {
+		return errNotMod
+	}
+	if err := f.validate(); err != nil {
+		return err
+	}
+	_, err := f.db.ExecContext(ctx, "UPDATE community_flairs SET text = ?, color = ? WHERE id = ?", f.Text, f.Color, f.ID)
+	return err
+}
+
+// Delete deletes the flair and removes it from the posts that have it.
+func (f *CommunityFlair) Delete(ctx context.Context, mod uid.ID) error {
+	if is, err := UserModOrAdmin(ctx, f.db, f.CommunityID, mod); err != nil {
+		return err
+	} else if !is {
+		return errNotMod
+	}
+	return msql.Transact(ctx, f.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE posts SET flair_id = NULL WHERE flair_id = ?", f.ID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM community_flairs WHERE id = ?", f.ID)
+		return err
+	})
+}
+
+// checkPostFlair returns an httperr.Error if flairID (0 for no flair) cannot be
+// the flair of a post in community.
+func checkPostFlair(ctx context.Context, db *sql.DB, community uid.ID, flairID uint) error {
+	if flairID == 0 {
+		var required bool
+		if err := db.QueryRowContext(ctx, "SELECT flair_required FROM communities WHERE id = ?", community).Scan(&required); err != nil {
+			return err
+		}
+		if required {
+			return httperr.NewBadRequest("flair-required", "Posts in this community must have a flair.")
+		}
+		return nil
+	}
+	flair, err := GetCommunityFlair(ctx, db, flairID)
+	if err != nil {
+		return err
+	}
+	if !flair.CommunityID.EqualsTo(community) {
+		return httperr.NewBadRequest("flair-not-in-community", "Flair does not belong to the community.")
+	}
+	return nil
+}
+
+// SetFlair sets the flair of p (flairID 0 removes it). Only the author of the
+// post, the moderators of its community, and admins can change the flair.
+func (p *Post) SetFlair(ctx context.Context, user uid.ID, flairID uint) error {
+	if is, err := p.authorModOrAdmin(ctx, user); err != nil {
+		return err
+	} else if !is {
+		return errNotAuthorNorMod
+	}
+	if err := checkPostFlair(ctx, p.db, p.CommunityID, flairID); err != nil {
+		return err
+	}
+
+	var id any
+	if flairID != 0 {
+		id = flairID
+	}
+	if _, err := p.db.ExecContext(ctx, "UPDATE posts SET flair_id = ? WHERE id = ?", id, p.ID); err != nil {
+		return err
+	}
+	p.Flair = nil
+	if flairID != 0 {
+		p.flairID = &flairID
+		return populatePostsFlairs(ctx, p.db, []*Post{p})
+	}
+	p.flairID = nil
+	return nil
+}
+
+// populatePostsFlairs sets the Flair field of the posts that have a flair.
+func populatePostsFlairs(ctx context.Context, db *sql.DB, posts []*Post) error {
+	var ids []any
+	for _, post := range posts {
+		if post.flairID != nil {
+			ids = append(ids, *post.flairID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	flairs, err := getCommunityFlairs(ctx, db, "WHERE id IN "+msql.InClauseQuestionMarks(len(ids)), ids...)
+	if err != nil {
+		return err
+	}
+	byID := make(map[uint]*CommunityFlair, len(flairs))
+	for _, f := range flairs {
+		byID[f.ID] = f
+	}
+	for _, post := range posts {
+		if post.flairID != nil {
+			post.Flair = byID[*post.flairID]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package core
+
+import "testing"
+
+func TestCommunityFlairValidate(t *testing.T) {
+	tests := []struct {
+		text, color string
+		wantText    string
+		wantColor   string
+		valid       bool
+	}{
+		{"Discussion", "#00ff00", "Discussion", "#00ff00", true},
+		{"  News ", "#ABCDEF", "News", "#abcdef", true},
+		{"   ", "#000000", "", "", false},
+		{"Meta", "red", "", "", false},
+		{"Meta", "#fff", "", "", false},
+		{"Meta", "", "", "", false},
+	}
+	for _, test := range tests {
+		f := &CommunityFlair{Text: test.text, Color: test.color}
+		err := f.validate()
+		if (err == nil) != test.valid {
+			t.Errorf("validate(%q, %q) error = %v, want valid %v", test.text, test.color, err, test.valid)
+			continue
+		}
+		if test.valid && (f.Text != test.wantText || f.Color != test.wantColor) {
+			t.Errorf("validate(%q, %q) = (%q, %q), want (%q, %q)", test.text, test.color, f.Text, f.Color, test.wantText, test.wantColor)
+		}
+	}
+}
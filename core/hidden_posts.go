@@ -0,0 +1,182 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// How long post views are kept. Posts viewed before this are shown again in
+// feeds that hide viewed posts.
+const postViewsRetention = time.Hour * 24 * 30
+
+// HidePost hides post from user's feeds. Hiding an already hidden post is not
+// an error.
+func HidePost(ctx context.Context, db *sql.DB, user, post uid.ID) error {
+	if _, err := GetPost(ctx, db, &post, "", nil, false); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, "INSERT INTO hidden_posts (user_id, post_id) VALUES (?, ?)", user, post)
+	if err != nil && msql.IsErrDuplicateErr(err) {
+		return nil
+	}
+	return err
+}
+
+// UnhidePost shows post, if it was hidden, in user's feeds again.
+func UnhidePost(ctx context.Context, db *sql.DB, user, post uid.ID) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM hidden_posts WHERE user_id = ? AND post_id = ?", user, post)
+	return err
+}
+
+// GetHiddenPosts returns the posts hidden by user, the most recently hidden
+// first. The pagination cursor, next, is from a previous result set (it's safe
+// for it to be empty).
+func GetHiddenPosts(ctx context.Context, db *sql.DB, user uid.ID, limit int, next string) (*FeedResultSet, error) {
+	query, args := "SELECT id, post_id FROM hidden_posts WHERE user_id = ? ", []any{user}
+	if next != "" {
+		id, err := strconv.ParseUint(next, 10, 32)
+		if err != nil {
+			return nil, ErrInvalidFeedCursor
+		}
+		query += "AND id <= ? "
+		args = append(args, id)
+	}
+	query += fmt.Sprintf("ORDER BY id DESC LIMIT %d", limit+1)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		hiddenIDs []uint
+		postIDs   []uid.ID
+	)
+	for rows.Next() {
+		var (
+			id   uint
+			post uid.ID
+		)
+		if err := rows.Scan(&id, &post); err != nil {
+			return nil, err
+		}
+		hiddenIDs, postIDs = append(hiddenIDs, id), append(postIDs, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	set := &FeedResultSet{Posts: []*Post{}}
+	if len(postIDs) > limit {
+		set.Next = strconv.FormatUint(uint64(hiddenIDs[limit]), 10)
+		postIDs = postIDs[:limit]
+	}
+	if len(postIDs) == 0 {
+		return set, nil
+	}
+
+	posts, err := GetPostsByIDs(ctx, db, &user, false, postIDs...)
+	if err != nil {
+		if err == errPostNotFound {
+			return set, nil
+		}
+		return nil, err
+	}
+	byID := make(map[uid.ID]*Post, len(posts))
+	for _, post := range posts {
+		byID[post.ID] = post
+	}
+	for _, id := range postIDs {
+		if post, ok := byID[id]; ok {
+			set.Posts = append(set.Posts, post)
+		}
+	}
+	return set, nil
+}
+
+// populatePostsHidden sets the HiddenByViewer field of posts.
+func populatePostsHidden(ctx context.Context, db *sql.DB, posts []*Post, viewer uid.ID) error {
+	args := []any{viewer}
+	for _, post := range posts {
+		args = append(args, post.ID)
+	}
+	rows, err := db.QueryContext(ctx, "SELECT post_id FROM hidden_posts WHERE user_id = ? AND post_id IN "+msql.InClauseQuestionMarks(len(posts)), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	hidden := make(map[uid.ID]bool)
+	for rows.Next() {
+		var id uid.ID
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		hidden[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, post := range posts {
+		post.HiddenByViewer = hidden[post.ID]
+	}
+	return nil
+}
+
+// hiddenPostsClause returns an SQL condition that's true for posts that are not
+// hidden by the user in the argument that follows it. The argument postID is
+// the column that holds the id of the post.
+func hiddenPostsClause(postID string) string {
+	return postID + " NOT IN (SELECT post_id FROM hidden_posts WHERE user_id = ?)"
+}
+
+// viewedPostsClause is like hiddenPostsClause but for viewed posts.
+func viewedPostsClause(postID string) string {
+	return postID + " NOT IN (SELECT post_id FROM post_views WHERE user_id = ?)"
+}
+
+// A PostView is a record of a user having seen a post.
+type PostView struct {
+	User     uid.ID
+	Post     uid.ID
+	ViewedAt time.Time
+}
+
+// SavePostViews saves views in a single query. Views of posts that don't exist
+// are skipped. If a user has already viewed a post, the time of the view is
+// updated.
+func SavePostViews(ctx context.Context, db *sql.DB, views []PostView) error {
+	if len(views) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString("INSERT INTO post_views (user_id, post_id, viewed_at) SELECT views.user_id, views.post_id, views.viewed_at FROM (")
+	args := make([]any, 0, len(views)*3)
+	for i, view := range views {
+		if i == 0 {
+			b.WriteString("SELECT ? AS user_id, ? AS post_id, ? AS viewed_at")
+		} else {
+			b.WriteString(" UNION ALL SELECT ?, ?, ?")
+		}
+		args = append(args, view.User, view.Post, view.ViewedAt)
+	}
+	b.WriteString(") AS views INNER JOIN posts ON posts.id = views.post_id ")
+	b.WriteString("ON DUPLICATE KEY UPDATE post_views.viewed_at = GREATEST(post_views.viewed_at, VALUES(viewed_at))")
+	_, err := db.ExecContext(ctx, b.String(), args...)
+	return err
+}
+
+// PurgeOldPostViews deletes the post views that are older than the retention
+// period.
+func PurgeOldPostViews(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM post_views WHERE viewed_at < ?", time.Now().Add(-postViewsRetention))
+	return err
+}
@@ -0,0 +1,299 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// HotnessConfig holds the parameters of the hotness algorithm (see
+// PostHotness). Communities may override the site-wide default.
+type HotnessConfig struct {
+	// Interval is the number of seconds after which a post needs ten times
+	// as many points to be as hot as a newly created post.
+	Interval int `yaml:"interval" json:"interval"`
+
+	// Tiers are the weights of upvotes. The first Tiers[0].UpTo upvotes of a
+	// post are worth Tiers[0].Weight points each, the ones after that up to
+	// Tiers[1].UpTo are worth Tiers[1].Weight points each, and so on. All the
+	// upvotes after the second-to-last tier are worth the weight of the last
+	// tier (the UpTo of the last tier is ignored).
+	Tiers []HotnessTier `yaml:"tiers" json:"tiers"`
+}
+
+// HotnessTier is a tier of HotnessConfig.Tiers.
+type HotnessTier struct {
+	UpTo   int `yaml:"upTo" json:"upTo"`
+	Weight int `yaml:"weight" json:"weight"`
+}
+
+// DefaultHotnessConfig returns the hotness config that's used if none is set
+// in the site config.
+func DefaultHotnessConfig() HotnessConfig {
+	return HotnessConfig{
+		Interval: 45000,
+		Tiers: []HotnessTier{
+			{UpTo: 3, Weight: 1},
+			{UpTo: 10, Weight: 3},
+			{UpTo: 20, Weight: 4},
+			{UpTo: 40, Weight: 5},
+			{Weight: 6},
+		},
+	}
+}
+
+const (
+	minHotnessInterval = 3600           // 1 hour.
+	maxHotnessInterval = 3600 * 24 * 30 // 30 days.
+	maxHotnessTiers    = 10
+	maxHotnessWeight   = 100
+)
+
+// Validate returns an httperr.Error if c is not a valid config.
+func (c *HotnessConfig) Validate() error {
+	if c.Interval < minHotnessInterval || c.Interval > maxHotnessInterval {
+		return httperr.NewBadRequest("invalid_hotness_interval", fmt.Sprintf("Hotness interval must be between %d and %d seconds.", minHotnessInterval, maxHotnessInterval))
+	}
+	if len(c.Tiers) == 0 || len(c.Tiers) > maxHotnessTiers {
+		return httperr.NewBadRequest("invalid_hotness_tiers", fmt.Sprintf("There must be between 1 and %d hotness tiers.", maxHotnessTiers))
+	}
+	for i, tier := range c.Tiers {
+		if tier.Weight < 0 || tier.Weight > maxHotnessWeight {
+			return httperr.NewBadRequest("invalid_hotness_weight", fmt.Sprintf("Hotness weights must be between 0 and %d.", maxHotnessWeight))
+		}
+		if i == len(c.Tiers)-1 {
+			break
+		}
+		if tier.UpTo <= 0 || (i > 0 && tier.UpTo <= c.Tiers[i-1].UpTo) {
+			return httperr.NewBadRequest("invalid_hotness_tiers", "Hotness tiers must be in increasing order.")
+		}
+	}
+	return nil
+}
+
+// Equal reports whether c and o are the same config. Either can be nil.
+func (c *HotnessConfig) Equal(o *HotnessConfig) bool {
+	if c == nil || o == nil {
+		return c == o
+	}
+	if c.Interval != o.Interval || len(c.Tiers) != len(o.Tiers) {
+		return false
+	}
+	for i := range c.Tiers {
+		if c.Tiers[i] != o.Tiers[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// points returns the weighted points of a post with upvotes upvotes.
+func (c *HotnessConfig) points(upvotes int) int {
+	s, counted := 0, 0
+	for i, tier := range c.Tiers {
+		n := upvotes - counted
+		if i < len(c.Tiers)-1 {
+			n = min(n, tier.UpTo-counted)
+		}
+		if n <= 0 {
+			break
+		}
+		s += n * tier.Weight
+		counted += n
+	}
+	return s
+}
+
+var (
+	// siteHotness is the site-wide default hotness config.
+	siteHotness = DefaultHotnessConfig()
+
+	// normalizeAllFeed is whether the hot "all" feed is sorted by the
+	// normalized hotness of posts (see communityHotness).
+	normalizeAllFeed = false
+)
+
+// SetHotnessDefaults sets the site-wide default hotness config, and whether the
+// hotness of posts is normalized across communities in the hot "all" feed.
+func SetHotnessDefaults(c HotnessConfig, normalize bool) error {
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("invalid hotness config: %w", err)
+	}
+	siteHotness = c
+	normalizeAllFeed = normalize
+	return nil
+}
+
+// communityHotness holds what's needed to calculate the hotness of posts of a
+// community.
+type communityHotness struct {
+	config HotnessConfig
+
+	// baseline is the weighted points of a typical post of the community (see
+	// UpdateCommunitiesHotnessBaseline).
+	baseline float64
+}
+
+// hotness returns the hotness of a post.
+//
+// The time component of hotness always decays over the site-wide interval, so
+// that the hotness of posts of different communities can be compared. For a
+// community with a different interval, the points component is scaled instead,
+// which orders the posts of the community the same way as if the time
+// component had decayed over the interval of the community.
+//
+// The normalized hotness is the hotness with the points component made
+// relative to the baseline of the community, so that the posts of slow
+// communities aren't buried by the posts of busy ones.
+func (h *communityHotness) hotness(upvotes, downvotes int, date time.Time) (hotness, normalized int) {
+	s := h.config.points(upvotes)
+	scale := float64(siteHotness.Interval) / float64(h.config.Interval)
+
+	order := math.Log10(math.Max(math.Abs(float64(s)), 1))
+	var sign float64
+	if s > 0 {
+		sign = 1
+	} else if s < 0 {
+		sign = -1
+	}
+
+	seconds := float64(date.Unix())
+	t := float64(sign*seconds) / float64(siteHotness.Interval)
+	hotness = int(math.Round((order*scale + t) * 10000000))
+	normalized = hotness - h.offset()
+	return
+}
+
+// offset returns the difference between the hotness and the normalized hotness
+// of the posts of the community, which depends only on the baseline and the
+// interval of the community.
+func (h *communityHotness) offset() int {
+	scale := float64(siteHotness.Interval) / float64(h.config.Interval)
+	return int(math.Round(math.Log10(math.Max(h.baseline, 1)) * scale * 10000000))
+}
+
+// scanCommunityHotness returns the communityHotness given the hotness_config
+// and hotness_baseline columns of a community.
+func scanCommunityHotness(config []byte, baseline float64) (*communityHotness, error) {
+	h := &communityHotness{config: siteHotness, baseline: baseline}
+	if config != nil {
+		if err := json.Unmarshal(config, &h.config); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// getCommunityHotness returns the communityHotness of community.
+func getCommunityHotness(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}, community uid.ID) (*communityHotness, error) {
+	var (
+		config   []byte
+		baseline float64
+	)
+	row := q.QueryRowContext(ctx, "SELECT hotness_config, hotness_baseline FROM communities WHERE id = ?", community)
+	if err := row.Scan(&config, &baseline); err != nil {
+		return nil, err
+	}
+	return scanCommunityHotness(config, baseline)
+}
+
+// SetHotnessConfig sets the hotness config of c. If config is nil, the
+// site-wide default is used. Only admins can change the hotness config of a
+// community, and the change takes effect for existing posts on their next vote
+// or when UpdateAllPostsHotness is run.
+func (c *Community) SetHotnessConfig(ctx context.Context, admin uid.ID, config *HotnessConfig) error {
+	if is, err := IsAdmin(c.db, &admin); err != nil {
+		return err
+	} else if !is {
+		return errNotAdmin
+	}
+
+	var data []byte
+	if config != nil {
+		if err := config.Validate(); err != nil {
+			return err
+		}
+		var err error
+		if data, err = json.Marshal(config); err != nil {
+			return err
+		}
+	}
+	if _, err := c.db.ExecContext(ctx, "UPDATE communities SET hotness_config = ? WHERE id = ?", data, c.ID); err != nil {
+		return err
+	}
+	c.HotnessConfig = config
+	return nil
+}
+
+// hotnessBaselinePeriod is the period over which the baseline of a community is
+// calculated.
+const hotnessBaselinePeriod = time.Hour * 24 * 30
+
+// UpdateCommunitiesHotnessBaseline recalculates the hotness baseline of all
+// communities, which is the weighted points of a post with the average number
+// of upvotes of the posts of the community created within the last
+// hotnessBaselinePeriod. The normalized hotness of the posts of the same period
+// of communities whose baseline changed is recalculated as well (older posts
+// are not expected to show up in the hot feed). It should be called
+// periodically.
+func UpdateCommunitiesHotnessBaseline(ctx context.Context, db *sql.DB) error {
+	since := time.Now().Add(-hotnessBaselinePeriod)
+	rows, err := db.QueryContext(ctx, `
+		SELECT communities.id, communities.hotness_config, communities.hotness_baseline, COALESCE(AVG(posts.upvotes), 0)
+		FROM communities
+		LEFT JOIN posts ON posts.community_id = communities.id AND posts.deleted = FALSE AND posts.created_at > ?
+		GROUP BY communities.id`, since)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	changed := make(map[uid.ID]*communityHotness)
+	for rows.Next() {
+		var (
+			id       uid.ID
+			config   []byte
+			baseline float64
+			upvotes  float64
+		)
+		if err := rows.Scan(&id, &config, &baseline, &upvotes); err != nil {
+			return err
+		}
+		h, err := scanCommunityHotness(config, 0)
+		if err != nil {
+			return err
+		}
+		if h.baseline = float64(h.config.points(int(math.Round(upvotes)))); h.baseline != baseline {
+			changed[id] = h
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, h := range changed {
+		err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, "UPDATE communities SET hotness_baseline = ? WHERE id = ?", h.baseline, id); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, "UPDATE posts SET normalized_hotness = hotness - ? WHERE community_id = ? AND deleted = FALSE AND created_at > ?", h.offset(), id, since)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Updated hotness baselines of %d communities", len(changed))
+	return nil
+}
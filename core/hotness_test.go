@@ -0,0 +1,51 @@
+package core
+
+import "testing"
+
+func TestHotnessConfigPoints(t *testing.T) {
+	// The points of the default config, as they were calculated before
+	// HotnessConfig existed.
+	want := func(upvotes int) int {
+		s := 0
+		for i := 1; i < upvotes+1; i++ {
+			if i <= 3 {
+				s += 1
+			} else if i <= 10 {
+				s += 3
+			} else if i <= 20 {
+				s += 4
+			} else if i <= 40 {
+				s += 5
+			} else {
+				s += 6
+			}
+		}
+		return s
+	}
+
+	c := DefaultHotnessConfig()
+	for upvotes := 0; upvotes < 100; upvotes++ {
+		if got := c.points(upvotes); got != want(upvotes) {
+			t.Errorf("points(%d) = %d, want %d", upvotes, got, want(upvotes))
+		}
+	}
+}
+
+func TestHotnessConfigValidate(t *testing.T) {
+	tests := []struct {
+		config HotnessConfig
+		valid  bool
+	}{
+		{DefaultHotnessConfig(), true},
+		{HotnessConfig{Interval: 90000, Tiers: []HotnessTier{{Weight: 1}}}, true},
+		{HotnessConfig{Interval: 60, Tiers: []HotnessTier{{Weight: 1}}}, false},
+		{HotnessConfig{Interval: 90000}, false},
+		{HotnessConfig{Interval: 90000, Tiers: []HotnessTier{{UpTo: 10, Weight: 1}, {UpTo: 5, Weight: 2}, {Weight: 3}}}, false},
+		{HotnessConfig{Interval: 90000, Tiers: []HotnessTier{{UpTo: 10, Weight: -1}, {Weight: 3}}}, false},
+	}
+	for i, test := range tests {
+		if err := test.config.Validate(); (err == nil) != test.valid {
+			t.Errorf("test %d: Validate() = %v, want valid %v", i, err, test.valid)
+		}
+	}
+}
@@ -16,24 +16,26 @@ import (
 type MuteType string
 
 func (t MuteType) Valid() bool {
-	return slices.Contains([]MuteType{"", MuteTypeUser, MuteTypeCommunity}, t)
+	return slices.Contains([]MuteType{"", MuteTypeUser, MuteTypeCommunity, MuteTypeFilter}, t)
 }
 
 const (
 	MuteTypeUser      = MuteType("user")
 	MuteTypeCommunity = MuteType("community")
+	MuteTypeFilter    = MuteType("filter") // Keyword, regex, or link domain filters on posts.
 )
 
 type Mute struct {
 	db *sql.DB
 
-	ID               int       `json:"-"`
-	PublicID         string    `json:"id"` // augmented id based on Type
-	User             uid.ID    `json:"-"`
-	Type             MuteType  `json:"type"`
-	MutedUserID      *uid.ID   `json:"mutedUserId,omitempty"`      // may be empty and omitted base on Type
-	MutedCommunityID *uid.ID   `json:"mutedCommunityId,omitempty"` // may be empty and omitted base on Type
-	CreatedAt        time.Time `json:"createdAt"`
+	ID               int         `json:"-"`
+	PublicID         string      `json:"id"` // augmented id based on Type
+	User             uid.ID      `json:"-"`
+	Type             MuteType    `json:"type"`
+	MutedUserID      *uid.ID     `json:"mutedUserId,omitempty"`      // may be empty and omitted base on Type
+	MutedCommunityID *uid.ID     `json:"mutedCommunityId,omitempty"` // may be empty and omitted base on Type
+	Filter           *MuteFilter `json:"filter,omitempty"`           // may be empty and omitted base on Type
+	CreatedAt        time.Time   `json:"createdAt"`
 
 	MutedUser      *User      `json:"mutedUser,omitempty"`
 	MutedCommunity *Community `json:"mutedCommunity,omitempty"`
@@ -46,6 +48,8 @@ func (m *Mute) setPrintID() {
 		s = "u_" + s
 	case MuteTypeCommunity:
 		s = "c_" + s
+	case MuteTypeFilter:
+		s = "f_" + s
 	default:
 		panic("unknown mute type")
 	}
@@ -65,6 +69,8 @@ func extractMuteID(s string) (t MuteType, id int, err error) {
 		t = MuteTypeUser
 	case "c_":
 		t = MuteTypeCommunity
+	case "f_":
+		t = MuteTypeFilter
 	default:
 		err = errMuteID
 		return
@@ -87,7 +93,13 @@ func GetMutes(ctx context.Context, db *sql.DB, user uid.ID) ([]*Mute, error) {
 		return nil, err
 	}
 
+	filterMutes, err := GetMutedFilters(ctx, db, user)
+	if err != nil {
+		return nil, err
+	}
+
 	all := append(communityMutes, userMutes...)
+	all = append(all, filterMutes...)
 	sort.Slice(all, func(i, j int) bool {
 		return all[i].CreatedAt.Before(all[j].CreatedAt)
 	})
@@ -193,12 +205,14 @@ func Unmute(ctx context.Context, db *sql.DB, user uid.ID, id string) error {
 		_, err = db.ExecContext(ctx, "delete from muted_communities where id = ? and user_id = ?", idInt, user)
 	case MuteTypeUser:
 		_, err = db.ExecContext(ctx, "delete from muted_users where id = ? and user_id = ?", idInt, user)
+	case MuteTypeFilter:
+		_, err = db.ExecContext(ctx, "delete from muted_filters where id = ? and user_id = ?", idInt, user)
 	}
 	return err
 }
 
-// ClearMutes clears all mutes of user if t is empty, otherwise it clears either
-// the community or the user mutes.
+// ClearMutes clears all mutes of user if t is empty, otherwise it clears only
+// the mutes of type t.
 func ClearMutes(ctx context.Context, db *sql.DB, user uid.ID, t MuteType) (err error) {
 	if t == "" || t == MuteTypeCommunity {
 		_, err = db.ExecContext(ctx, "DELETE FROM muted_communities WHERE user_id = ?", user)
@@ -208,6 +222,12 @@ func ClearMutes(ctx context.Context, db *sql.DB, user uid.ID, t MuteType) (err e
 	}
 	if t == "" || t == MuteTypeUser {
 		_, err = db.ExecContext(ctx, "DELETE FROM muted_users where user_id = ?", user)
+		if err != nil {
+			return
+		}
+	}
+	if t == "" || t == MuteTypeFilter {
+		_, err = db.ExecContext(ctx, "DELETE FROM muted_filters WHERE user_id = ?", user)
 	}
 	return
 }
@@ -0,0 +1,216 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// MuteFilterType is the type of a filter mute (a mute of type MuteTypeFilter).
+type MuteFilterType string
+
+const (
+	MuteFilterKeyword = MuteFilterType("keyword") // Case-insensitive substring of post titles.
+	MuteFilterRegex   = MuteFilterType("regex")   // Regular expression matched against post titles.
+	MuteFilterDomain  = MuteFilterType("domain")  // Link domain (including its subdomains) of link posts.
+)
+
+func (t MuteFilterType) Valid() bool {
+	return t == MuteFilterKeyword || t == MuteFilterRegex || t == MuteFilterDomain
+}
+
+const (
+	maxMuteFilterLength = 255
+	maxMuteFiltersCount = 200 // Per user.
+)
+
+// MuteFilter is the filter of a mute of type MuteTypeFilter. Posts matching the
+// filter are hidden from feeds until the filter expires.
+type MuteFilter struct {
+	Type      MuteFilterType `json:"type"`
+	Value     string         `json:"value"`
+	ExpiresAt *time.Time     `json:"expiresAt"` // If nil, the filter never expires.
+}
+
+var domainRegexp = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// normalize validates f and normalizes its value. It always returns an
+// httperr.Error.
+func (f *MuteFilter) normalize() error {
+	if !f.Type.Valid() {
+		return httperr.NewBadRequest("invalid_filter_type", "Invalid filter type.")
+	}
+	if f.Type != MuteFilterRegex {
+		f.Value = strings.TrimSpace(f.Value)
+	}
+	if f.Value == "" {
+		return httperr.NewBadRequest("empty_filter", "Filter cannot be empty.")
+	}
+	if utf8.RuneCountInString(f.Value) > maxMuteFilterLength {
+		return httperr.NewBadRequest("filter_too_long", "Filter is too long.")
+	}
+
+	switch f.Type {
+	case MuteFilterRegex:
+		re, err := syntax.Parse(f.Value, syntax.Perl)
+		if err != nil {
+			return httperr.NewBadRequest("invalid_filter_regex", "Invalid regular expression: "+err.Error()+".")
+		}
+		if hasNestedRepeat(re, false) {
+			return httperr.NewBadRequest("invalid_filter_regex", "Nested quantifiers (like (a+)+) are not allowed in regular expressions.")
+		}
+	case MuteFilterDomain:
+		// Accept URLs as well as bare domains.
+		value := strings.ToLower(f.Value)
+		if strings.Contains(value, "://") {
+			if u, err := url.Parse(value); err == nil {
+				value = u.Hostname()
+			}
+		}
+		value = strings.TrimPrefix(value, "www.")
+		if !domainRegexp.MatchString(value) {
+			return httperr.NewBadRequest("invalid_filter_domain", "Invalid domain.")
+		}
+		f.Value = value
+	}
+
+	if f.ExpiresAt != nil && !f.ExpiresAt.After(time.Now()) {
+		return httperr.NewBadRequest("invalid_filter_expiry", "Filter expiry must be in the future.")
+	}
+	return nil
+}
+
+// isRepeat reports whether re matches its subexpression more than once.
+func isRepeat(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpStar, syntax.OpPlus:
+		return true
+	case syntax.OpRepeat:
+		return re.Max != 1
+	}
+	return false
+}
+
+// hasNestedRepeat reports whether re has a repetition within a repetition,
+// which may make a backtracking regex engine (like the one of MariaDB, where
+// regex filters are run) take exponential time. If inRepeat is true, re is
+// within a repetition.
+func hasNestedRepeat(re *syntax.Regexp, inRepeat bool) bool {
+	repeat := isRepeat(re)
+	if repeat && inRepeat {
+		return true
+	}
+	for _, sub := range re.Sub {
+		if hasNestedRepeat(sub, inRepeat || repeat) {
+			return true
+		}
+	}
+	return false
+}
+
+// MuteFilterPosts hides posts that match filter from the feeds of user.
+func MuteFilterPosts(ctx context.Context, db *sql.DB, user uid.ID, filter MuteFilter) error {
+	if err := filter.normalize(); err != nil {
+		return err
+	}
+	if filter.Type == MuteFilterRegex {
+		// The syntax of the regex engine of the database differs slightly from
+		// that of Go, so the filter is compiled with the database as well.
+		var match bool
+		err := db.QueryRowContext(ctx, "SELECT '' REGEXP ?", filter.Value).Scan(&match)
+		if msql.IsErrRegexpErr(err) {
+			return httperr.NewBadRequest("invalid_filter_regex", "Invalid regular expression.")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM muted_filters WHERE user_id = ?", user).Scan(&count); err != nil {
+		return err
+	}
+	if count >= maxMuteFiltersCount {
+		return httperr.NewForbidden("too_many_filters", "Maximum number of filters reached.")
+	}
+
+	var expiresAt msql.NullTime
+	if filter.ExpiresAt != nil {
+		expiresAt = msql.NewNullTime(filter.ExpiresAt.UTC())
+	}
+	// If the filter exists already, only its expiry is updated.
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO muted_filters (user_id, filter_type, value, expires_at) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE expires_at = VALUES(expires_at)`,
+		user, filter.Type, filter.Value, expiresAt)
+	return err
+}
+
+// GetMutedFilters returns the unexpired filter mutes of user. Expired filters
+// are deleted.
+func GetMutedFilters(ctx context.Context, db *sql.DB, user uid.ID) ([]*Mute, error) {
+	if _, err := db.ExecContext(ctx, "DELETE FROM muted_filters WHERE user_id = ? AND expires_at <= UTC_TIMESTAMP()", user); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT id, filter_type, value, expires_at, created_at FROM muted_filters WHERE user_id = ? ORDER BY id", user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mutes []*Mute
+	for rows.Next() {
+		mute := &Mute{db: db, User: user, Type: MuteTypeFilter, Filter: &MuteFilter{}}
+		var expiresAt msql.NullTime
+		if err := rows.Scan(&mute.ID, &mute.Filter.Type, &mute.Filter.Value, &expiresAt, &mute.CreatedAt); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			mute.Filter.ExpiresAt = &expiresAt.Time
+		}
+		mute.setPrintID()
+		mutes = append(mutes, mute)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return mutes, nil
+}
+
+// mutedFiltersClause returns an SQL condition that's true for posts that don't
+// match any of the unexpired filter mutes of a user, whose id is the only
+// argument of the condition. The argument postID is the column that holds the
+// id of the post.
+func mutedFiltersClause(postID string) string {
+	return "NOT EXISTS (SELECT 1 FROM posts AS filtered_posts, muted_filters " +
+		"WHERE filtered_posts.id = " + postID + " AND muted_filters.user_id = ? " +
+		"AND (muted_filters.expires_at IS NULL OR muted_filters.expires_at > UTC_TIMESTAMP()) AND (" +
+		"(muted_filters.filter_type = 'keyword' AND LOCATE(muted_filters.value, filtered_posts.title) > 0) OR " +
+		"(muted_filters.filter_type = 'regex' AND filtered_posts.title REGEXP muted_filters.value) OR " +
+		"(muted_filters.filter_type = 'domain' AND filtered_posts.link_info IS NOT NULL AND (" +
+		"LOWER(JSON_VALUE(filtered_posts.link_info, '$.h')) = muted_filters.value OR " +
+		"LOWER(JSON_VALUE(filtered_posts.link_info, '$.h')) LIKE CONCAT('%.', muted_filters.value)))))"
+}
+
+// whereFiltered is like whereMuted, except that it excludes posts that match
+// the filter mutes of viewer. The argument postID is the column that holds the
+// id of the post.
+func whereFiltered(where, postID string, args []any, viewer uid.ID) (string, []any) {
+	if !(where == "" || strings.TrimSpace(strings.ToUpper(where)) == "WHERE") {
+		where += " AND "
+	}
+	where += mutedFiltersClause(postID) + " "
+	args = append(args, viewer)
+	return where, args
+}
@@ -13,6 +13,7 @@ func TestExtractMuteID(t *testing.T) {
 	}{
 		{"c_1", MuteTypeCommunity, 1, false},
 		{"u_1234", MuteTypeUser, 1234, false},
+		{"f_56", MuteTypeFilter, 56, false},
 		{"", "", 0, true},
 		{"1234", "", 0, true},
 		{"c_", "", 0, true},
@@ -25,3 +26,30 @@ func TestExtractMuteID(t *testing.T) {
 
 	}
 }
+
+func TestMuteFilterNormalize(t *testing.T) {
+	cases := []struct {
+		filter    MuteFilter
+		wantValue string
+		wantErr   bool
+	}{
+		{MuteFilter{Type: MuteFilterKeyword, Value: "  golang "}, "golang", false},
+		{MuteFilter{Type: MuteFilterKeyword, Value: "   "}, "", true},
+		{MuteFilter{Type: MuteFilterRegex, Value: "^go(lang)?$"}, "^go(lang)?$", false},
+		{MuteFilter{Type: MuteFilterRegex, Value: "(unclosed"}, "", true},
+		{MuteFilter{Type: MuteFilterRegex, Value: "^(a+)+$"}, "", true},
+		{MuteFilter{Type: MuteFilterRegex, Value: "(x*y{2,})*"}, "", true},
+		{MuteFilter{Type: MuteFilterRegex, Value: "(ab)+c*d{3}"}, "(ab)+c*d{3}", false},
+		{MuteFilter{Type: MuteFilterDomain, Value: "Example.com"}, "example.com", false},
+		{MuteFilter{Type: MuteFilterDomain, Value: "https://www.example.com/path"}, "example.com", false},
+		{MuteFilter{Type: MuteFilterDomain, Value: "exa%mple.com"}, "", true},
+		{MuteFilter{Type: "other", Value: "x"}, "", true},
+	}
+	for _, item := range cases {
+		filter := item.filter
+		err := filter.normalize()
+		if (err != nil) != item.wantErr || (err == nil && filter.Value != item.wantValue) {
+			t.Errorf("%q (%v): got value %q, err %v", item.filter.Value, item.filter.Type, filter.Value, err)
+		}
+	}
+}
@@ -397,6 +397,17 @@ func (n *Notification) SendPushNotification(ctx context.Context) error {
 		return err
 	}
 
+	options := webPushOptions(topic, 30) // topic is for collapsing comments
+	if options == nil {
+		return nil
+	}
+	return SendPushNotification(ctx, n.db, n.UserID, data, options)
+}
+
+// webPushOptions returns the options for sending a web push notification with
+// the given topic and ttl (in seconds). Notifications with the same topic
+// replace each other. It returns nil if push notifications are not enabled.
+func webPushOptions(topic string, ttl int) *webpush.Options {
 	pushMutex.RLock()
 	enabled := pushNotifsEnabled
 	email := webmasterEmail
@@ -407,13 +418,13 @@ func (n *Notification) SendPushNotification(ctx context.Context) error {
 		return nil
 	}
 
-	return SendPushNotification(ctx, n.db, n.UserID, data, &webpush.Options{
+	return &webpush.Options{
 		Subscriber:      email,
 		VAPIDPublicKey:  keys.Public,
 		VAPIDPrivateKey: keys.Private,
-		TTL:             30,
-		Topic:           topic, // For collapsing comments
-	})
+		TTL:             ttl,
+		Topic:           topic,
+	}
 }
 
 func (n *Notification) ResetUserNewNotificationsCount(ctx context.Context) error {
@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"math"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -41,6 +40,7 @@ const (
 	PostTypeText = PostType(iota)
 	PostTypeImage
 	PostTypeLink
+	PostTypeCrosspost
 )
 
 // Valid reports whether t is a valid PostType.
@@ -59,6 +59,8 @@ func (t PostType) MarshalText() ([]byte, error) {
 		s = "image"
 	case PostTypeLink:
 		s = "link"
+	case PostTypeCrosspost:
+		s = "crosspost"
 	default:
 		return nil, errPostTypeUnsupported
 	}
@@ -74,6 +76,8 @@ func (p *PostType) UnmarshalText(text []byte) error {
 		*p = PostTypeImage
 	case "link":
 		*p = PostTypeLink
+	case "crosspost":
+		*p = PostTypeCrosspost
 	default:
 		return errPostTypeUnsupported
 	}
@@ -107,6 +111,7 @@ type Post struct {
 
 	CommunityID          uid.ID        `json:"communityId"`
 	CommunityName        string        `json:"communityName"`
+	CommunityNSFW        bool          `json:"communityNsfw"`
 	CommunityProPic      *images.Image `json:"communityProPic"`
 	CommunityBannerImage *images.Image `json:"communityBannerImage"`
 
@@ -119,6 +124,14 @@ type Post struct {
 
 	Link *PostLink `json:"link,omitempty"` // what's sent to the client
 
+	crosspostOf uid.NullID // the original post, if the post is a crosspost
+
+	// Crosspost is set if the post is a crosspost.
+	Crosspost *CrosspostSource `json:"crosspost,omitempty"`
+
+	// The number of (undeleted) crossposts of the post.
+	NumCrossposts int `json:"noCrossposts"`
+
 	Locked   bool       `json:"locked"`
 	LockedBy uid.NullID `json:"lockedBy"`
 
@@ -131,7 +144,17 @@ type Post struct {
 	Downvotes int `json:"downvotes"`
 	Points    int `json:"-"` // Upvotes - Downvotes
 
+	NSFW    bool `json:"nsfw"`
+	Spoiler bool `json:"spoiler"`
+
+	flairID *uint           // nil if the post has no flair
+	Flair   *CommunityFlair `json:"flair"`
+
 	Hotness        int           `json:"hotness"`
+	NormHotness    int           `json:"-"` // See communityHotness.hotness.
+	Rising         int           `json:"-"` // See PostRising.
+	Controversy    int           `json:"-"` // See PostControversy.
+	Best           int           `json:"-"` // See PostBestScore.
 	CreatedAt      time.Time     `json:"createdAt"`
 	EditedAt       msql.NullTime `json:"editedAt"`
 	LastActivityAt time.Time     `json:"lastActivityAt"`
@@ -161,6 +184,7 @@ type Post struct {
 
 	AuthorMutedByViewer    bool `json:"isAuthorMuted"`
 	CommunityMutedByViewer bool `json:"isCommunityMuted"`
+	HiddenByViewer         bool `json:"isHidden"`
 
 	Community *Community `json:"community,omitempty"`
 	Author    *User      `json:"author,omitempty"`
@@ -176,9 +200,11 @@ var selectPostCols = []string{
 	"users.deleted_at is not null",
 	"posts.community_id",
 	"communities.name",
+	"communities.nsfw",
 	"posts.title",
 	"posts.body",
 	"posts.link_info",
+	"posts.crosspost_of",
 	"posts.locked",
 	"posts.locked_at",
 	"posts.locked_by",
@@ -188,7 +214,14 @@ var selectPostCols = []string{
 	"posts.upvotes",
 	"posts.downvotes",
 	"posts.points",
+	"posts.nsfw",
+	"posts.spoiler",
+	"posts.flair_id",
 	"posts.hotness",
+	"posts.normalized_hotness",
+	"posts.rising",
+	"posts.controversy",
+	"posts.best",
 	"posts.created_at",
 	"posts.edited_at",
 	"posts.last_activity_at",
@@ -197,6 +230,7 @@ var selectPostCols = []string{
 	"posts.deleted_by",
 	"posts.deleted_as",
 	"posts.no_comments",
+	"posts.no_crossposts",
 	"posts.deleted_by",
 	"posts.deleted_content",
 	"posts.deleted_content_at",
@@ -316,9 +350,11 @@ func scanPosts(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.ID)
 			&post.AuthorDeleted,
 			&post.CommunityID,
 			&post.CommunityName,
+			&post.CommunityNSFW,
 			&post.Title,
 			&post.Body,
 			&linkBytes,
+			&post.crosspostOf,
 			&post.Locked,
 			&post.LockedAt,
 			&post.LockedBy,
@@ -328,7 +364,14 @@ func scanPosts(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.ID)
 			&post.Upvotes,
 			&post.Downvotes,
 			&post.Points,
+			&post.NSFW,
+			&post.Spoiler,
+			&post.flairID,
 			&post.Hotness,
+			&post.NormHotness,
+			&post.Rising,
+			&post.Controversy,
+			&post.Best,
 			&post.CreatedAt,
 			&post.EditedAt,
 			&post.LastActivityAt,
@@ -337,6 +380,7 @@ func scanPosts(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.ID)
 			&post.DeletedBy,
 			&post.DeletedAs,
 			&post.NumComments,
+			&post.NumCrossposts,
 			&post.DeletedBy,
 			&post.DeletedContent,
 			&post.DeletedContentAt,
@@ -414,11 +458,23 @@ func scanPosts(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.ID)
 				}
 			}
 		}
+		if err := populatePostsHidden(ctx, db, posts, *viewer); err != nil {
+			return nil, err
+		}
 	}
 
 	if err := populatePostsImages(ctx, db, posts); err != nil {
 		return nil, err
 	}
+	if err := blurFlaggedPostsImages(ctx, db, posts, viewer); err != nil {
+		return nil, err
+	}
+	if err := populatePostsFlairs(ctx, db, posts); err != nil {
+		return nil, err
+	}
+	if err := populatePostsCrossposts(ctx, db, posts, viewer); err != nil {
+		return nil, err
+	}
 
 	viewerAdmin, err := IsAdmin(db, viewer)
 	if err != nil {
@@ -573,6 +629,10 @@ type createPostOpts struct {
 	link      postLink
 	linkImage []byte // for link posts (thumbnail image)
 	image     uid.ID // for image posts
+
+	crosspostOf uid.ID // for crossposts
+	nsfw        bool
+	flair       uint // 0 for no flair
 }
 
 func createPost(ctx context.Context, db *sql.DB, opts *createPostOpts) (*Post, error) {
@@ -587,6 +647,15 @@ func createPost(ctx context.Context, db *sql.DB, opts *createPostOpts) (*Post, e
 		return nil, errUserBannedFromCommunity
 	}
 
+	if err := checkPostFlair(ctx, db, opts.community, opts.flair); err != nil {
+		return nil, err
+	}
+
+	hot, err := getCommunityHotness(ctx, db, opts.community)
+	if err != nil {
+		return nil, err
+	}
+
 	// Truncate title and body if max lengths are exceeded.
 	var post Post
 	post.Title = opts.title
@@ -595,6 +664,7 @@ func createPost(ctx context.Context, db *sql.DB, opts *createPostOpts) (*Post, e
 	post.CreatedAt = time.Now()
 	post.ID = uid.New()
 	post.PublicID = utils.GenerateStringID(publicPostIDLength)
+	post.Hotness, post.NormHotness = hot.hotness(0, 0, post.CreatedAt)
 
 	cols := []msql.ColumnValue{
 		{Name: "id", Value: post.ID},
@@ -605,7 +675,17 @@ func createPost(ctx context.Context, db *sql.DB, opts *createPostOpts) (*Post, e
 		{Name: "title", Value: post.Title},
 		{Name: "body", Value: post.Body},
 		{Name: "created_at", Value: post.CreatedAt},
-		{Name: "hotness", Value: PostHotness(0, 0, post.CreatedAt)},
+		{Name: "hotness", Value: post.Hotness},
+		{Name: "normalized_hotness", Value: post.NormHotness},
+	}
+	if opts.flair != 0 {
+		cols = append(cols, msql.ColumnValue{Name: "flair_id", Value: opts.flair})
+	}
+	if opts.nsfw {
+		cols = append(cols, msql.ColumnValue{Name: "nsfw", Value: true})
+	}
+	if opts.postType == PostTypeCrosspost {
+		cols = append(cols, msql.ColumnValue{Name: "crosspost_of", Value: opts.crosspostOf})
 	}
 
 	if opts.postType == PostTypeLink {
@@ -643,6 +723,13 @@ func createPost(ctx context.Context, db *sql.DB, opts *createPostOpts) (*Post, e
 		return nil, err
 	}
 
+	if opts.postType == PostTypeCrosspost {
+		if _, err = tx.ExecContext(ctx, "UPDATE posts SET no_crossposts = no_crossposts + 1 WHERE id = ?", opts.crosspostOf); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
 	if opts.postType == PostTypeImage {
 		// Save image post image.
 		if _, err = tx.ExecContext(ctx, "INSERT INTO post_images (post_id, image_id) VALUES (?, ?)", post.ID, opts.image); err != nil {
@@ -650,7 +737,7 @@ func createPost(ctx context.Context, db *sql.DB, opts *createPostOpts) (*Post, e
 			return nil, err
 		}
 		// Delete row from temp images table.
-		if _, err = tx.ExecContext(ctx, "DELETE FROM temp_images_2 WHERE image_id = ?", opts.image); err != nil {
+		if _, err = tx.ExecContext(ctx, "DELETE FROM temp_images_2 WHERE image_id = ? AND purpose = ?", opts.image, tempImagePost); err != nil {
 			tx.Rollback()
 			return nil, err
 		}
@@ -683,17 +770,20 @@ func createPost(ctx context.Context, db *sql.DB, opts *createPostOpts) (*Post, e
 	return GetPost(ctx, db, &post.ID, "", nil, false)
 }
 
-func CreateTextPost(ctx context.Context, db *sql.DB, author, community uid.ID, title string, body string) (*Post, error) {
+// CreateTextPost creates a text post. The argument flair is the ID of the
+// post's flair (0 for no flair).
+func CreateTextPost(ctx context.Context, db *sql.DB, author, community uid.ID, title string, body string, flair uint) (*Post, error) {
 	return createPost(ctx, db, &createPostOpts{
 		postType:  PostTypeText,
 		author:    author,
 		community: community,
 		title:     title,
 		body:      body,
+		flair:     flair,
 	})
 }
 
-func CreateImagePost(ctx context.Context, db *sql.DB, author, community uid.ID, title string, imageID uid.ID) (*Post, error) {
+func CreateImagePost(ctx context.Context, db *sql.DB, author, community uid.ID, title string, imageID uid.ID, flair uint) (*Post, error) {
 	// We don't check whether the image belongs to the person who uploaded it.
 	// This is not a big deal as image ids are hard to guess.
 
@@ -704,6 +794,14 @@ func CreateImagePost(ctx context.Context, db *sql.DB, author, community uid.ID,
 		}
 		return nil, err
 	}
+	// Images uploaded for messages cannot be used.
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM temp_images_2 WHERE image_id = ? AND purpose <> ?", imageID, tempImagePost).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errImageNotFound
+	}
 
 	return createPost(ctx, db, &createPostOpts{
 		postType:  PostTypeImage,
@@ -711,6 +809,7 @@ func CreateImagePost(ctx context.Context, db *sql.DB, author, community uid.ID,
 		community: community,
 		title:     title,
 		image:     imageID,
+		flair:     flair,
 	})
 }
 
@@ -768,7 +867,7 @@ func getLinkPostImage(u *url.URL) []byte {
 	return nil
 }
 
-func CreateLinkPost(ctx context.Context, db *sql.DB, author, community uid.ID, title string, link string) (*Post, error) {
+func CreateLinkPost(ctx context.Context, db *sql.DB, author, community uid.ID, title string, link string, flair uint) (*Post, error) {
 	errInvalidURL := httperr.NewBadRequest("invalid-url", "Invalid URL.")
 	if len(link) > maxPostLinkLength {
 		link = link[:maxPostLinkLength]
@@ -796,6 +895,7 @@ func CreateLinkPost(ctx context.Context, db *sql.DB, author, community uid.ID, t
 			URL:      u.String(),
 			Hostname: u.Hostname(),
 		},
+		flair: flair,
 	})
 }
 
@@ -912,6 +1012,12 @@ func (p *Post) Delete(ctx context.Context, user uid.ID, g UserGroup, deleteConte
 			if _, err := tx.ExecContext(ctx, q, true, now, user, g, p.ID); err != nil {
 				return err
 			}
+			if p.crosspostOf.Valid && !p.Deleted {
+				q = "UPDATE posts SET no_crossposts = no_crossposts - 1 WHERE id = ? AND no_crossposts > 0"
+				if _, err := tx.ExecContext(ctx, q, p.crosspostOf.ID); err != nil {
+					return err
+				}
+			}
 		}
 
 		if deleteContent {
@@ -1169,7 +1275,7 @@ func (p *Post) Vote(ctx context.Context, user uid.ID, up bool) error {
 		point = -1
 	}
 
-	query := "UPDATE posts SET points = points + ?, hotness = ?"
+	query := "UPDATE posts SET points = points + ?"
 	newUpvotes, newDownvotes := p.Upvotes, p.Downvotes
 	if up {
 		query += ", upvotes = upvotes + 1"
@@ -1180,11 +1286,15 @@ func (p *Post) Vote(ctx context.Context, user uid.ID, up bool) error {
 	}
 	query += " WHERE id = ?"
 
-	_, err = tx.ExecContext(ctx, query, point, PostHotness(newUpvotes, newDownvotes, p.CreatedAt), p.ID)
+	_, err = tx.ExecContext(ctx, query, point, p.ID)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
+	if err = p.updateScoresTx(ctx, tx, newUpvotes, newDownvotes); err != nil {
+		tx.Rollback()
+		return err
+	}
 
 	if err = tx.Commit(); err != nil {
 		return err
@@ -1236,7 +1346,7 @@ func (p *Post) DeleteVote(ctx context.Context, user uid.ID) error {
 		return err
 	}
 
-	query := "UPDATE posts SET points = points + ?, hotness = ?"
+	query := "UPDATE posts SET points = points + ?"
 	point := 1
 	newUpvotes, newDownvotes := p.Upvotes, p.Downvotes
 	if up {
@@ -1249,11 +1359,15 @@ func (p *Post) DeleteVote(ctx context.Context, user uid.ID) error {
 	}
 	query += " WHERE id = ?"
 
-	_, err = tx.ExecContext(ctx, query, point, PostHotness(newUpvotes, newDownvotes, p.CreatedAt), p.ID)
+	_, err = tx.ExecContext(ctx, query, point, p.ID)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
+	if err = p.updateScoresTx(ctx, tx, newUpvotes, newDownvotes); err != nil {
+		tx.Rollback()
+		return err
+	}
 
 	if err = tx.Commit(); err != nil {
 		return err
@@ -1300,7 +1414,7 @@ func (p *Post) ChangeVote(ctx context.Context, user uid.ID, up bool) error {
 		return err
 	}
 
-	query := "UPDATE posts SET points = points + ?, hotness = ?"
+	query := "UPDATE posts SET points = points + ?"
 	points := 2
 	newUpvotes, newDownvotes := p.Upvotes, p.Downvotes
 	if dbUp {
@@ -1315,11 +1429,15 @@ func (p *Post) ChangeVote(ctx context.Context, user uid.ID, up bool) error {
 	}
 	query += " WHERE id = ?"
 
-	_, err = tx.ExecContext(ctx, query, points, PostHotness(newUpvotes, newDownvotes, p.CreatedAt), p.ID)
+	_, err = tx.ExecContext(ctx, query, points, p.ID)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
+	if err = p.updateScoresTx(ctx, tx, newUpvotes, newDownvotes); err != nil {
+		tx.Rollback()
+		return err
+	}
 
 	if err = tx.Commit(); err != nil {
 		return err
@@ -1383,35 +1501,68 @@ func getComments(ctx context.Context, db *sql.DB, viewer *uid.ID, where string,
 
 // CommentsCursor is an API pagination cursor.
 type CommentsCursor struct {
-	Upvotes int
-	NextID  uid.ID
+	Score  int // See CommentSort.scoreSQL.
+	NextID uid.ID
 }
 
-// GetComments populates c.Comments and returns the next comment's cursor.
-func (p *Post) GetComments(ctx context.Context, viewer *uid.ID, cursor *CommentsCursor) (*CommentsCursor, error) {
+// GetComments populates c.Comments, sorted by sort, and returns the next
+// comment's cursor.
+func (p *Post) GetComments(ctx context.Context, viewer *uid.ID, sort CommentSort, cursor *CommentsCursor) (*CommentsCursor, error) {
+	score := sort.scoreSQL()
 	var args []any
-	where := "WHERE comments.post_id = ? "
+	query := "SELECT comments.id, " + score + " AS score FROM comments WHERE comments.post_id = ? "
 	args = append(args, p.ID)
-	if cursor != nil {
-		where += "AND (comments.upvotes, comments.id) <= (?, ?) "
-		args = append(args, cursor.Upvotes, cursor.NextID)
+	if sort == CommentSortOld {
+		if cursor != nil {
+			query += "AND comments.id >= ? "
+			args = append(args, cursor.NextID)
+		}
+		query += "ORDER BY comments.id LIMIT ?"
+	} else {
+		if cursor != nil {
+			query += "AND (" + score + ", comments.id) <= (?, ?) "
+			args = append(args, cursor.Score, cursor.NextID)
+		}
+		query += "ORDER BY score DESC, comments.id DESC LIMIT ?"
 	}
-	where += "ORDER BY upvotes DESC, comments.id DESC LIMIT ?"
 	args = append(args, commentsFetchLimit+1)
 
-	all, err := getComments(ctx, p.db, viewer, where, args...)
+	rows, err := p.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	comments := all
+	var (
+		resIDs []uid.ID
+		scores []int
+	)
+	for rows.Next() {
+		var (
+			id uid.ID
+			s  int
+		)
+		if err := rows.Scan(&id, &s); err != nil {
+			return nil, err
+		}
+		resIDs = append(resIDs, id)
+		scores = append(scores, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
 	var nextCursor *CommentsCursor
-	if len(all) >= commentsFetchLimit+1 {
+	if len(resIDs) >= commentsFetchLimit+1 {
 		nextCursor = new(CommentsCursor)
-		nextCursor.Upvotes = all[commentsFetchLimit].Upvotes
-		nextCursor.NextID = all[commentsFetchLimit].ID
-		comments = all[:commentsFetchLimit]
+		nextCursor.Score = scores[commentsFetchLimit]
+		nextCursor.NextID = resIDs[commentsFetchLimit]
+		resIDs = resIDs[:commentsFetchLimit]
+	}
+
+	comments, err := GetCommentsByIDs(ctx, p.db, viewer, resIDs...)
+	if err != nil {
+		return nil, err
 	}
 	p.Comments = comments
 
@@ -1446,9 +1597,10 @@ func (p *Post) GetComments(ctx context.Context, viewer *uid.ID, cursor *Comments
 		}
 		p.Comments = append(p.Comments, c2...)
 	}
+	p.Comments = sortCommentsTree(p.Comments, sort)
 
 	if nextCursor != nil {
-		p.CommentsNext.String = strconv.Itoa(nextCursor.Upvotes) + "." + nextCursor.NextID.String()
+		p.CommentsNext.String = strconv.Itoa(nextCursor.Score) + "." + nextCursor.NextID.String()
 		p.CommentsNext.Valid = true
 	}
 
@@ -1594,42 +1746,24 @@ func IsPostLocked(ctx context.Context, db *sql.DB, post uid.ID) (bool, error) {
 	return is, err
 }
 
-// PostHotness calculates the hotness score of a post.
+// PostHotness calculates the hotness score of a post with the site-wide
+// default hotness config.
 func PostHotness(upvotes, downvotes int, date time.Time) int {
-	s := 0
-	for i := 1; i < upvotes+1; i++ {
-		if i <= 3 {
-			s += 1
-		} else if i <= 6 {
-			s += 3
-		} else if i <= 10 {
-			s += 3
-		} else if i <= 20 {
-			s += 4
-		} else if i <= 40 {
-			s += 5
-		} else {
-			s += 6
-		}
-	}
-
-	order := math.Log10(math.Max(math.Abs(float64(s)), 1))
-	var sign float64
-	if s > 0 {
-		sign = 1
-	} else if s < 0 {
-		sign = -1
-	}
-
-	interval := float64(45000) // float64(69000)
-	seconds := float64(date.Unix())
-	hotness := order + float64(sign*seconds)/interval
-	return int(math.Round(hotness * 10000000))
+	h := communityHotness{config: siteHotness}
+	hotness, _ := h.hotness(upvotes, downvotes, date)
+	return hotness
 }
 
-// UpdateAllPostsHotness applies the PostHotness function to every row in the
-// posts table.
+// UpdateAllPostsHotness recalculates the hotness (with the hotness config of
+// the community of each post), controversy, and best scores of every row in
+// the posts table, and it updates the rising scores of posts with
+// UpdatePostsRising.
 func UpdateAllPostsHotness(ctx context.Context, db *sql.DB) error {
+	if err := UpdateCommunitiesHotnessBaseline(ctx, db); err != nil {
+		return err
+	}
+	hots := make(map[uid.ID]*communityHotness)
+
 	var (
 		limit      = 1000
 		lastID     uid.ID
@@ -1638,7 +1772,7 @@ func UpdateAllPostsHotness(ctx context.Context, db *sql.DB) error {
 	)
 
 	for goOn {
-		rows, err := db.QueryContext(ctx, "SELECT id, upvotes, downvotes, created_at FROM posts WHERE id > ? ORDER BY id LIMIT ?", lastID, limit)
+		rows, err := db.QueryContext(ctx, "SELECT id, community_id, upvotes, downvotes, created_at FROM posts WHERE id > ? ORDER BY id LIMIT ?", lastID, limit)
 		if err != nil {
 			return err
 		}
@@ -1652,13 +1786,24 @@ func UpdateAllPostsHotness(ctx context.Context, db *sql.DB) error {
 		for rows.Next() {
 			upvotes, downvotes := 0, 0
 			var createdAt time.Time
-			var postID uid.ID
-			if err := rows.Scan(&postID, &upvotes, &downvotes, &createdAt); err != nil {
+			var postID, communityID uid.ID
+			if err := rows.Scan(&postID, &communityID, &upvotes, &downvotes, &createdAt); err != nil {
 				tx.Rollback()
 				rows.Close()
 				return err
 			}
-			if _, err := tx.ExecContext(ctx, "UPDATE posts SET hotness = ? WHERE id = ?", PostHotness(upvotes, downvotes, createdAt), postID); err != nil {
+			hot, ok := hots[communityID]
+			if !ok {
+				if hot, err = getCommunityHotness(ctx, db, communityID); err != nil {
+					tx.Rollback()
+					rows.Close()
+					return err
+				}
+				hots[communityID] = hot
+			}
+			hotness, normalized := hot.hotness(upvotes, downvotes, createdAt)
+			if _, err := tx.ExecContext(ctx, "UPDATE posts SET hotness = ?, normalized_hotness = ?, controversy = ?, best = ? WHERE id = ?",
+				hotness, normalized, PostControversy(upvotes, downvotes), PostBestScore(upvotes, downvotes), postID); err != nil {
 				log.Println(err)
 				goOn = false
 				break
@@ -1688,9 +1833,18 @@ func UpdateAllPostsHotness(ctx context.Context, db *sql.DB) error {
 	}
 
 	log.Printf("Fixed %v posts", totalCount)
-	return nil
+	return UpdatePostsRising(ctx, db)
 }
 
+// tempImagePurpose is what a temp image (a row of the temp_images_2 table) was
+// uploaded for. Temp images can only be used for what they were uploaded for.
+type tempImagePurpose int
+
+const (
+	tempImagePost    = tempImagePurpose(iota) // Image of an image post (see SavePostImage).
+	tempImageMessage                          // Image of a message (see SaveMessageImage).
+)
+
 func SavePostImage(ctx context.Context, db *sql.DB, authorID uid.ID, image []byte) (*images.ImageRecord, error) {
 	var imageID uid.ID
 	err := msql.Transact(ctx, db, func(tx *sql.Tx) (err error) {
@@ -1704,7 +1858,7 @@ func SavePostImage(ctx context.Context, db *sql.DB, authorID uid.ID, image []byt
 			return fmt.Errorf("failed to save post image (author: %v): %w", authorID, err)
 		}
 		imageID = id
-		if _, err := tx.ExecContext(ctx, "INSERT INTO temp_images_2 (user_id, image_id) values (?, ?)", authorID, imageID); err != nil {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO temp_images_2 (user_id, image_id, purpose) values (?, ?, ?)", authorID, imageID, tempImagePost); err != nil {
 			return fmt.Errorf("failed to insert row into temp_images (author: %v, image: %v): %w", authorID, imageID, err)
 		}
 		return nil
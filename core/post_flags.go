@@ -0,0 +1,134 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// NSFWPreference is how a user wants NSFW posts (posts that are marked NSFW or
+// that are in NSFW communities) to be shown.
+type NSFWPreference int
+
+const (
+	NSFWPreferenceBlur = NSFWPreference(iota) // The images of posts marked NSFW are blurred.
+	NSFWPreferenceShow                        // Nothing is blurred nor hidden.
+	NSFWPreferenceHide                        // NSFW posts are excluded from feeds and search.
+)
+
+// Valid reports whether p is a valid NSFWPreference.
+func (p NSFWPreference) Valid() bool {
+	_, err := p.MarshalText()
+	return err == nil
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (p NSFWPreference) MarshalText() ([]byte, error) {
+	switch p {
+	case NSFWPreferenceBlur:
+		return []byte("blur"), nil
+	case NSFWPreferenceShow:
+		return []byte("show"), nil
+	case NSFWPreferenceHide:
+		return []byte("hide"), nil
+	}
+	return nil, fmt.Errorf("cannot marshal unsupported NSFWPreference (%v)", int(p))
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (p *NSFWPreference) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "blur":
+		*p = NSFWPreferenceBlur
+	case "show":
+		*p = NSFWPreferenceShow
+	case "hide":
+		*p = NSFWPreferenceHide
+	default:
+		return fmt.Errorf("cannot unmarshal unsupported NSFWPreference: %v", string(text))
+	}
+	return nil
+}
+
+// GetNSFWPreference returns the NSFW preference of user. If user is nil (a
+// logged out user), NSFWPreferenceBlur is returned.
+func GetNSFWPreference(ctx context.Context, db *sql.DB, user *uid.ID) (NSFWPreference, error) {
+	p := NSFWPreferenceBlur
+	if user == nil {
+		return p, nil
+	}
+	err := db.QueryRowContext(ctx, "SELECT nsfw_preference FROM users WHERE id = ?", *user).Scan(&p)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return p, err
+}
+
+// nsfwPostsClause returns an SQL condition that's true for posts that are not
+// NSFW. The argument postID is the column that holds the id of the post.
+func nsfwPostsClause(postID string) string {
+	return "NOT EXISTS (SELECT 1 FROM posts AS nsfw_posts " +
+		"INNER JOIN communities AS nsfw_communities ON nsfw_communities.id = nsfw_posts.community_id " +
+		"WHERE nsfw_posts.id = " + postID + " AND (nsfw_posts.nsfw = TRUE OR nsfw_communities.nsfw = TRUE))"
+}
+
+var errNotAuthorNorMod = httperr.NewForbidden("not-author-nor-mod", "You are neither the author nor a moderator.")
+
+// authorModOrAdmin reports whether user is the author of p, a moderator of its
+// community, or an admin.
+func (p *Post) authorModOrAdmin(ctx context.Context, user uid.ID) (bool, error) {
+	if p.AuthorID.EqualsTo(user) {
+		return true, nil
+	}
+	return UserModOrAdmin(ctx, p.db, p.CommunityID, user)
+}
+
+// SetFlags marks p as NSFW and/or as a spoiler. Only the author of the post,
+// the moderators of its community, and admins can change the flags.
+func (p *Post) SetFlags(ctx context.Context, user uid.ID, nsfw, spoiler bool) error {
+	if is, err := p.authorModOrAdmin(ctx, user); err != nil {
+		return err
+	} else if !is {
+		return errNotAuthorNorMod
+	}
+
+	if _, err := p.db.ExecContext(ctx, "UPDATE posts SET nsfw = ?, spoiler = ? WHERE id = ?", nsfw, spoiler, p.ID); err != nil {
+		return err
+	}
+	p.NSFW, p.Spoiler = nsfw, spoiler
+	return nil
+}
+
+// blurFlaggedPostsImages blurs the image copies of the posts that are marked as
+// spoilers, and of the ones that are NSFW (marked NSFW or in an NSFW community)
+// unless viewer prefers otherwise.
+func blurFlaggedPostsImages(ctx context.Context, db *sql.DB, posts []*Post, viewer *uid.ID) error {
+	var flagged []*Post
+	for _, post := range posts {
+		if post.NSFW || post.CommunityNSFW || post.Spoiler {
+			flagged = append(flagged, post)
+		}
+	}
+	if len(flagged) == 0 {
+		return nil
+	}
+
+	pref, err := GetNSFWPreference(ctx, db, viewer)
+	if err != nil {
+		return err
+	}
+	for _, post := range flagged {
+		if post.Spoiler || pref != NSFWPreferenceShow {
+			if post.Image != nil {
+				post.Image.BlurCopies()
+			}
+			if post.Link != nil && post.Link.Image != nil {
+				post.Link.Image.BlurCopies()
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"math"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+const (
+	// risingWindow is the window of time over which the vote velocity of a
+	// post is calculated for the rising feed.
+	risingWindow = time.Hour * 6
+
+	// risingMaxAge is the age after which a post is no longer considered for
+	// the rising feed.
+	risingMaxAge = time.Hour * 24
+
+	// bestZScore is the z-score used in the Wilson score interval of
+	// PostBestScore (80% confidence).
+	bestZScore = 1.281551565545
+)
+
+// PostRising calculates the rising score of a post, which is its net votes per
+// hour over the last risingWindow (or over its age, if it's younger than that).
+// The votes are the ones cast within the last risingWindow. Posts older than
+// risingMaxAge have a rising score of 0.
+func PostRising(recentUpvotes, recentDownvotes int, createdAt time.Time) int {
+	age := time.Since(createdAt)
+	if age > risingMaxAge {
+		return 0
+	}
+	hours := math.Max(math.Min(age.Hours(), risingWindow.Hours()), 1)
+	velocity := float64(recentUpvotes-recentDownvotes) / hours
+	return int(math.Round(velocity * 10000000))
+}
+
+// PostControversy calculates the controversy score of a post. Posts with many
+// upvotes and downvotes in roughly equal numbers score the highest.
+func PostControversy(upvotes, downvotes int) int {
+	if upvotes <= 0 || downvotes <= 0 {
+		return 0
+	}
+	magnitude := float64(upvotes + downvotes)
+	balance := float64(min(upvotes, downvotes)) / float64(max(upvotes, downvotes))
+	return int(math.Round(math.Pow(magnitude, balance) * 10000000))
+}
+
+// PostBestScore calculates the confidence-based score of a post, which is the
+// lower bound of the Wilson score interval of the fraction of upvotes.
+func PostBestScore(upvotes, downvotes int) int {
+	n := float64(upvotes + downvotes)
+	if n <= 0 {
+		return 0
+	}
+	z := bestZScore
+	p := float64(upvotes) / n
+	lower := (p + z*z/(2*n) - z*math.Sqrt((p*(1-p)+z*z/(4*n))/n)) / (1 + z*z/n)
+	return int(math.Round(lower * 10000000))
+}
+
+// postRecentVotes returns the number of upvotes and downvotes post received
+// within the last risingWindow.
+func postRecentVotes(ctx context.Context, tx *sql.Tx, post uid.ID) (upvotes, downvotes int, err error) {
+	err = tx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(up = TRUE), 0), COALESCE(SUM(up = FALSE), 0)
+		FROM post_votes WHERE post_id = ? AND created_at > ?`,
+		post, time.Now().Add(-risingWindow)).Scan(&upvotes, &downvotes)
+	return
+}
+
+// updateScoresTx updates the hotness, rising, controversy, and best scores of
+// p, given its new upvotes and downvotes count. It's to be called within the
+// same transaction as the vote.
+func (p *Post) updateScoresTx(ctx context.Context, tx *sql.Tx, upvotes, downvotes int) error {
+	hot, err := getCommunityHotness(ctx, tx, p.CommunityID)
+	if err != nil {
+		return err
+	}
+
+	recentUp, recentDown := 0, 0
+	if time.Since(p.CreatedAt) <= risingMaxAge {
+		if recentUp, recentDown, err = postRecentVotes(ctx, tx, p.ID); err != nil {
+			return err
+		}
+	}
+
+	p.Hotness, p.NormHotness = hot.hotness(upvotes, downvotes, p.CreatedAt)
+	p.Rising = PostRising(recentUp, recentDown, p.CreatedAt)
+	p.Controversy = PostControversy(upvotes, downvotes)
+	p.Best = PostBestScore(upvotes, downvotes)
+	_, err = tx.ExecContext(ctx, "UPDATE posts SET hotness = ?, normalized_hotness = ?, rising = ?, controversy = ?, best = ? WHERE id = ?",
+		p.Hotness, p.NormHotness, p.Rising, p.Controversy, p.Best, p.ID)
+	return err
+}
+
+// UpdatePostsRising recalculates the rising scores of posts whose scores may
+// have changed since they were last calculated (which happens even without new
+// votes, because votes fall out of risingWindow and posts age). It should be
+// called periodically.
+func UpdatePostsRising(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, created_at FROM posts
+		WHERE deleted = FALSE AND (rising <> 0 OR created_at > ?)`, time.Now().Add(-risingMaxAge))
+	if err != nil {
+		return err
+	}
+
+	type item struct {
+		id        uid.ID
+		createdAt time.Time
+	}
+	var items []item
+	for rows.Next() {
+		var it item
+		if err := rows.Scan(&it.id, &it.createdAt); err != nil {
+			rows.Close()
+			return err
+		}
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, it := range items {
+		up, down := 0, 0
+		if time.Since(it.createdAt) <= risingMaxAge {
+			if up, down, err = postRecentVotes(ctx, tx, it.id); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE posts SET rising = ? WHERE id = ?", PostRising(up, down, it.createdAt), it.id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Updated rising scores of %d posts", len(items))
+	return nil
+}
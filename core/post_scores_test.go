@@ -0,0 +1,41 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPostScores(t *testing.T) {
+	// Each case is a pair of (upvotes, downvotes) where a should score higher
+	// than b.
+	best := []struct{ a, b [2]int }{
+		{[2]int{10, 0}, [2]int{1, 0}},
+		{[2]int{100, 10}, [2]int{10, 1}},
+		{[2]int{5, 0}, [2]int{50, 50}},
+		{[2]int{1, 0}, [2]int{0, 0}},
+	}
+	for _, c := range best {
+		if a, b := PostBestScore(c.a[0], c.a[1]), PostBestScore(c.b[0], c.b[1]); a <= b {
+			t.Errorf("PostBestScore%v (%d) should be greater than PostBestScore%v (%d)", c.a, a, c.b, b)
+		}
+	}
+
+	controversy := []struct{ a, b [2]int }{
+		{[2]int{50, 50}, [2]int{100, 1}},
+		{[2]int{100, 100}, [2]int{10, 10}},
+		{[2]int{1, 1}, [2]int{100, 0}},
+	}
+	for _, c := range controversy {
+		if a, b := PostControversy(c.a[0], c.a[1]), PostControversy(c.b[0], c.b[1]); a <= b {
+			t.Errorf("PostControversy%v (%d) should be greater than PostControversy%v (%d)", c.a, a, c.b, b)
+		}
+	}
+
+	now := time.Now()
+	if PostRising(10, 0, now.Add(-time.Hour)) <= PostRising(10, 0, now.Add(-time.Hour*5)) {
+		t.Error("PostRising should be greater for the younger post with the same votes")
+	}
+	if got := PostRising(10, 0, now.Add(-risingMaxAge-time.Hour)); got != 0 {
+		t.Errorf("PostRising of an old post should be 0 (got %d)", got)
+	}
+}
@@ -0,0 +1,413 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// SearchType is the type of a search result.
+type SearchType string
+
+const (
+	SearchTypePost      = SearchType("post")
+	SearchTypeComment   = SearchType("comment")
+	SearchTypeCommunity = SearchType("community")
+	SearchTypeUser      = SearchType("user")
+)
+
+func (t SearchType) Valid() bool {
+	switch t {
+	case SearchTypePost, SearchTypeComment, SearchTypeCommunity, SearchTypeUser:
+		return true
+	}
+	return false
+}
+
+// SearchSort is the order in which search results are returned.
+type SearchSort string
+
+const (
+	SearchSortRelevance = SearchSort("relevance")
+	SearchSortNew       = SearchSort("new")
+	SearchSortTop       = SearchSort("top")
+)
+
+func (s SearchSort) Valid() bool {
+	switch s {
+	case SearchSortRelevance, SearchSortNew, SearchSortTop:
+		return true
+	}
+	return false
+}
+
+const (
+	searchMinQueryLength = 2
+	searchMaxQueryLength = 256
+)
+
+var (
+	ErrInvalidSearchCursor = httperr.NewBadRequest("search/invalid-cursor", "Invalid search pagination cursor.")
+	ErrInvalidSearchSort   = httperr.NewBadRequest("search/invalid-sort", "Invalid search sort.")
+	ErrInvalidSearchType   = httperr.NewBadRequest("search/invalid-type", "Invalid search type.")
+)
+
+// searchIndexes are the FULLTEXT indexes that Search uses, one per search type.
+// The columns of a MATCH clause have to be exactly the columns of an index.
+var searchIndexes = map[SearchType]struct {
+	table   string
+	columns []string
+}{
+	SearchTypePost:      {"posts", []string{"title", "body"}},
+	SearchTypeComment:   {"comments", []string{"body"}},
+	SearchTypeCommunity: {"communities", []string{"name", "about"}},
+	SearchTypeUser:      {"users", []string{"username", "about_me"}},
+}
+
+const searchIndexName = "ft_search"
+
+func searchMatchClause(t SearchType) string {
+	index := searchIndexes[t]
+	cols := make([]string, len(index.columns))
+	for i, col := range index.columns {
+		cols[i] = index.table + "." + col
+	}
+	return "MATCH (" + strings.Join(cols, ", ") + ") AGAINST (? IN NATURAL LANGUAGE MODE)"
+}
+
+type SearchOptions struct {
+	Query string
+	Types []SearchType // If empty, all types are searched.
+
+	// If either Community or Author is set, only posts and comments are
+	// searched.
+	Community *uid.ID
+	Author    *uid.ID
+
+	From, To    *time.Time // Optional created_at range (inclusive of From, exclusive of To).
+	IncludeNSFW bool       // Whether to include NSFW posts, and content from NSFW communities.
+
+	Sort   SearchSort
+	Viewer *uid.ID
+	Limit  int
+	Next   string // The pagination cursor, taken from previous API response.
+}
+
+func (o *SearchOptions) searches(t SearchType) bool {
+	if (o.Community != nil || o.Author != nil) && !(t == SearchTypePost || t == SearchTypeComment) {
+		return false
+	}
+	if len(o.Types) == 0 {
+		return true
+	}
+	for _, item := range o.Types {
+		if item == t {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchResult is a single search result. Exactly one of Post, Comment,
+// Community, and User is non-nil, depending on Type.
+type SearchResult struct {
+	Type      SearchType `json:"type"`
+	Post      *Post      `json:"post,omitempty"`
+	Comment   *Comment   `json:"comment,omitempty"`
+	Community *Community `json:"community,omitempty"`
+	User      *User      `json:"user,omitempty"`
+}
+
+type SearchResultSet struct {
+	Results []*SearchResult `json:"results"`
+	Next    string          `json:"next"`
+}
+
+// searchRow is a row of the search query before hydration.
+type searchRow struct {
+	Type   SearchType
+	ID     uid.ID
+	Score  float64
+	Points int
+}
+
+// Search does a full-text search of posts, comments, communities, and users.
+// Deleted content, content in communities that the viewer has muted, and
+// content by users that the viewer has muted is excluded.
+func Search(ctx context.Context, db *sql.DB, opts *SearchOptions) (*SearchResultSet, error) {
+	opts.Query = strings.TrimSpace(opts.Query)
+	if n := utf8.RuneCountInString(opts.Query); n < searchMinQueryLength || n > searchMaxQueryLength {
+		return nil, httperr.NewBadRequest("search/invalid-query",
+			fmt.Sprintf("Search query must be between %d and %d characters long.", searchMinQueryLength, searchMaxQueryLength))
+	}
+	if opts.Sort == "" {
+		opts.Sort = SearchSortRelevance
+	}
+	if !opts.Sort.Valid() {
+		return nil, ErrInvalidSearchSort
+	}
+	if opts.IncludeNSFW {
+		if pref, err := GetNSFWPreference(ctx, db, opts.Viewer); err != nil {
+			return nil, err
+		} else if pref == NSFWPreferenceHide {
+			opts.IncludeNSFW = false
+		}
+	}
+	for _, t := range opts.Types {
+		if !t.Valid() {
+			return nil, ErrInvalidSearchType
+		}
+	}
+
+	var (
+		parts []string
+		args  []any
+	)
+	for _, t := range []SearchType{SearchTypePost, SearchTypeComment, SearchTypeCommunity, SearchTypeUser} {
+		if opts.searches(t) {
+			part, partArgs := buildSearchQueryPart(t, opts)
+			parts = append(parts, part)
+			args = append(args, partArgs...)
+		}
+	}
+	if len(parts) == 0 {
+		return &SearchResultSet{Results: []*SearchResult{}}, nil
+	}
+
+	query := "SELECT type, id, score, points FROM (" + strings.Join(parts, " UNION ALL ") + ") AS results "
+	offset := 0
+	switch opts.Sort {
+	case SearchSortNew:
+		if opts.Next != "" {
+			var id uid.ID
+			if err := id.UnmarshalText([]byte(opts.Next)); err != nil {
+				return nil, ErrInvalidSearchCursor
+			}
+			query += "WHERE id <= ? "
+			args = append(args, id)
+		}
+		query += "ORDER BY id DESC "
+	case SearchSortTop:
+		if opts.Next != "" {
+			points, id, err := NextPointsIDCursor(opts.Next)
+			if err != nil {
+				return nil, ErrInvalidSearchCursor
+			}
+			query += "WHERE points < ? OR (points = ? AND id <= ?) "
+			args = append(args, points, points, *id)
+		}
+		query += "ORDER BY points DESC, id DESC "
+	case SearchSortRelevance:
+		if opts.Next != "" {
+			n, err := strconv.Atoi(opts.Next)
+			if err != nil || n < 0 {
+				return nil, ErrInvalidSearchCursor
+			}
+			offset = n
+		}
+		query += "ORDER BY score DESC, id DESC "
+	}
+	query += "LIMIT ? OFFSET ?"
+	args = append(args, opts.Limit+1, offset)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("db error on search query '%s': %w", query, err)
+	}
+	defer rows.Close()
+
+	var results []*searchRow
+	for rows.Next() {
+		row := &searchRow{}
+		if err := rows.Scan(&row.Type, &row.ID, &row.Score, &row.Points); err != nil {
+			return nil, err
+		}
+		results = append(results, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	set := &SearchResultSet{}
+	if len(results) > opts.Limit {
+		switch opts.Sort {
+		case SearchSortNew:
+			set.Next = results[opts.Limit].ID.String()
+		case SearchSortTop:
+			set.Next = strconv.Itoa(results[opts.Limit].Points) + "." + results[opts.Limit].ID.String()
+		case SearchSortRelevance:
+			set.Next = strconv.Itoa(offset + opts.Limit)
+		}
+		results = results[:opts.Limit]
+	}
+
+	if set.Results, err = hydrateSearchResults(ctx, db, opts.Viewer, results); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// buildSearchQueryPart returns the query that searches items of type t. Each
+// part selects the columns (type, id, score, points) so that the parts can be
+// combined with a UNION.
+func buildSearchQueryPart(t SearchType, opts *SearchOptions) (string, []any) {
+	var (
+		table  = searchIndexes[t].table
+		match  = searchMatchClause(t)
+		points string
+		where  = "WHERE " + match + " "
+		args   = []any{string(t), opts.Query, opts.Query}
+	)
+
+	switch t {
+	case SearchTypePost:
+		points = "posts.points"
+		where += "AND posts.deleted = FALSE "
+	case SearchTypeComment:
+		points = "comments.points"
+		where += "AND comments.deleted_at IS NULL AND comments.post_id NOT IN (SELECT id FROM posts WHERE deleted = TRUE) "
+	case SearchTypeCommunity:
+		points = "communities.no_members"
+		where += "AND communities.deleted_at IS NULL "
+	case SearchTypeUser:
+		points = "users.points"
+		where += "AND users.deleted_at IS NULL AND users.banned_at IS NULL "
+	}
+
+	if opts.From != nil {
+		where += "AND " + table + ".created_at >= ? "
+		args = append(args, *opts.From)
+	}
+	if opts.To != nil {
+		where += "AND " + table + ".created_at < ? "
+		args = append(args, *opts.To)
+	}
+
+	switch t {
+	case SearchTypePost, SearchTypeComment:
+		if opts.Community != nil {
+			where += "AND " + table + ".community_id = ? "
+			args = append(args, *opts.Community)
+		}
+		if opts.Author != nil {
+			where += "AND " + table + ".user_id = ? "
+			args = append(args, *opts.Author)
+		}
+		if !opts.IncludeNSFW {
+			where += "AND " + table + ".community_id NOT IN (SELECT id FROM communities WHERE nsfw = TRUE) "
+			if t == SearchTypePost {
+				where += "AND posts.nsfw = FALSE "
+			} else {
+				where += "AND comments.post_id NOT IN (SELECT id FROM posts WHERE nsfw = TRUE) "
+			}
+		}
+		if opts.Viewer != nil {
+			where, args = whereMuted(where, table, args, *opts.Viewer, opts.Community == nil)
+		}
+	case SearchTypeCommunity:
+		if !opts.IncludeNSFW {
+			where += "AND communities.nsfw = FALSE "
+		}
+		if opts.Viewer != nil {
+			where += "AND communities.id NOT IN (SELECT community_id FROM muted_communities WHERE user_id = ?) "
+			args = append(args, *opts.Viewer)
+		}
+	case SearchTypeUser:
+		if opts.Viewer != nil {
+			where += "AND users.id NOT IN (SELECT muted_user_id FROM muted_users WHERE user_id = ?) "
+			args = append(args, *opts.Viewer)
+		}
+	}
+
+	query := fmt.Sprintf("SELECT ? AS type, %s.id AS id, %s AS score, %s AS points FROM %s %s", table, match, points, table, where)
+	return query, args
+}
+
+// hydrateSearchResults fetches the items of rows, preserving the order of rows.
+// Items that can no longer be found (because they were deleted in the meantime,
+// for instance) are skipped.
+func hydrateSearchResults(ctx context.Context, db *sql.DB, viewer *uid.ID, rows []*searchRow) ([]*SearchResult, error) {
+	ids := make(map[SearchType][]uid.ID)
+	for _, row := range rows {
+		ids[row.Type] = append(ids[row.Type], row.ID)
+	}
+
+	items := make(map[uid.ID]*SearchResult)
+	if len(ids[SearchTypePost]) > 0 {
+		posts, err := GetPostsByIDs(ctx, db, viewer, false, ids[SearchTypePost]...)
+		if err != nil && err != errPostNotFound {
+			return nil, err
+		}
+		for _, post := range posts {
+			items[post.ID] = &SearchResult{Type: SearchTypePost, Post: post}
+		}
+	}
+	if len(ids[SearchTypeComment]) > 0 {
+		comments, err := GetCommentsByIDs(ctx, db, viewer, ids[SearchTypeComment]...)
+		if err != nil && err != errCommentNotFound {
+			return nil, err
+		}
+		for _, comment := range comments {
+			items[comment.ID] = &SearchResult{Type: SearchTypeComment, Comment: comment}
+		}
+	}
+	if len(ids[SearchTypeCommunity]) > 0 {
+		comms, err := GetCommunitiesByIDs(ctx, db, ids[SearchTypeCommunity], viewer)
+		if err != nil && err != errCommunityNotFound {
+			return nil, err
+		}
+		for _, comm := range comms {
+			items[comm.ID] = &SearchResult{Type: SearchTypeCommunity, Community: comm}
+		}
+	}
+	if len(ids[SearchTypeUser]) > 0 {
+		users, err := GetUsersByIDs(ctx, db, ids[SearchTypeUser], viewer)
+		if err != nil && err != errUserNotFound {
+			return nil, err
+		}
+		for _, user := range users {
+			items[user.ID] = &SearchResult{Type: SearchTypeUser, User: user}
+		}
+	}
+
+	results := make([]*SearchResult, 0, len(rows))
+	for _, row := range rows {
+		if item, ok := items[row.ID]; ok && item.Type == row.Type {
+			results = append(results, item)
+		}
+	}
+	return results, nil
+}
+
+// RebuildSearchIndex drops and recreates the FULLTEXT indexes used by Search.
+// Indexes that don't exist are simply created.
+func RebuildSearchIndex(ctx context.Context, db *sql.DB) error {
+	for _, t := range []SearchType{SearchTypePost, SearchTypeComment, SearchTypeCommunity, SearchTypeUser} {
+		index := searchIndexes[t]
+		var exists bool
+		if err := db.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM information_schema.statistics
+				WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?
+			)`, index.table, searchIndexName).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			if _, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s DROP INDEX %s", index.table, searchIndexName)); err != nil {
+				return fmt.Errorf("failed to drop search index on %s: %w", index.table, err)
+			}
+		}
+		query := fmt.Sprintf("ALTER TABLE %s ADD FULLTEXT INDEX %s (%s)", index.table, searchIndexName, strings.Join(index.columns, ", "))
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to create search index on %s: %w", index.table, err)
+		}
+	}
+	return nil
+}
@@ -113,6 +113,7 @@ type User struct {
 	NumPosts         int             `json:"noPosts"`
 	NumComments      int             `json:"noComments"`
 	LastSeen         time.Time       `json:"-"` // accurate to within 5 minutes
+	LastVisit        msql.NullTime   `json:"-"` // LastSeen as of before the current visit (see UserSeen).
 	CreatedAt        time.Time       `json:"createdAt"`
 	Deleted          bool            `json:"deleted"`
 	DeletedAt        msql.NullTime   `json:"deletedAt,omitempty"`
@@ -124,6 +125,15 @@ type User struct {
 	RememberFeedSort        bool     `json:"rememberFeedSort"`
 	EmbedsOff               bool     `json:"embedsOff"`
 	HideUserProfilePictures bool     `json:"hideUserProfilePictures"`
+	DMPushNotificationsOff  bool     `json:"dmPushNotificationsOff"`
+
+	// How NSFW posts are shown to the user.
+	NSFWPreference NSFWPreference `json:"nsfwPreference"`
+
+	// Who can start conversations with the user. DMMinPoints is only used if
+	// DMPrivacy is DMPrivacyPoints.
+	DMPrivacy   DMPrivacy `json:"dmPrivacy"`
+	DMMinPoints int       `json:"dmMinPoints"`
 
 	// No banned users are supposed to be logged in. Make sure to log them out
 	// before banning.
@@ -226,6 +236,7 @@ func buildSelectUserQuery(where string) string {
 		"users.no_comments",
 		"users.notifications_new_count",
 		"users.last_seen",
+		"users.last_visit",
 		"users.created_at",
 		"users.deleted_at",
 		"users.banned_at",
@@ -235,6 +246,10 @@ func buildSelectUserQuery(where string) string {
 		"users.remember_feed_sort",
 		"users.embeds_off",
 		"users.hide_user_profile_pictures",
+		"users.dm_push_notifications_off",
+		"users.dm_privacy",
+		"users.dm_min_points",
+		"users.nsfw_preference",
 	}
 	cols = append(cols, images.ImageColumns("pro_pic")...)
 	joins := []string{
@@ -325,6 +340,7 @@ func scanUsers(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.ID)
 			&u.NumComments,
 			&u.NumNewNotifications,
 			&u.LastSeen,
+			&u.LastVisit,
 			&u.CreatedAt,
 			&u.DeletedAt,
 			&u.BannedAt,
@@ -334,6 +350,10 @@ func scanUsers(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.ID)
 			&u.RememberFeedSort,
 			&u.EmbedsOff,
 			&u.HideUserProfilePictures,
+			&u.DMPushNotificationsOff,
+			&u.DMPrivacy,
+			&u.DMMinPoints,
+			&u.NSFWPreference,
 		}
 
 		proPic := &images.Image{}
@@ -566,6 +586,15 @@ func (u *User) Update(ctx context.Context) error {
 	}
 
 	u.About.String = utils.TruncateUnicodeString(u.About.String, maxUserProfileAboutLength)
+	if !u.DMPrivacy.Valid() {
+		return httperr.NewBadRequest("invalid_dm_privacy", "Invalid DM privacy setting.")
+	}
+	if u.DMMinPoints < 0 {
+		u.DMMinPoints = 0
+	}
+	if !u.NSFWPreference.Valid() {
+		return httperr.NewBadRequest("invalid_nsfw_preference", "Invalid NSFW preference.")
+	}
 	_, err := u.db.ExecContext(ctx, `
 	UPDATE users SET
 		email = ?, 
@@ -575,7 +604,11 @@ func (u *User) Update(ctx context.Context) error {
 		home_feed = ?,
 		remember_feed_sort = ?,
 		embeds_off = ?,
-		hide_user_profile_pictures = ?
+		hide_user_profile_pictures = ?,
+		dm_push_notifications_off = ?,
+		dm_privacy = ?,
+		dm_min_points = ?,
+		nsfw_preference = ?
 	WHERE id = ?`,
 		u.EmailPublic,
 		u.About,
@@ -585,6 +618,10 @@ func (u *User) Update(ctx context.Context) error {
 		u.RememberFeedSort,
 		u.EmbedsOff,
 		u.HideUserProfilePictures,
+		u.DMPushNotificationsOff,
+		u.DMPrivacy,
+		u.DMMinPoints,
+		u.NSFWPreference,
 		u.ID)
 	return err
 }
@@ -834,10 +871,20 @@ func (u *User) Saw(ctx context.Context, userIP string) error {
 	return err
 }
 
+// visitGap is the minimum duration of inactivity after which a user coming back
+// to the site is considered to be a new visit.
+const visitGap = time.Hour
+
 // UserSeen updates user's LastSeen to current time. It also updates the IP
-// address of the user.
+// address of the user. If the user was last seen more than visitGap ago, which
+// begins a new visit, the user's LastVisit is set to the old LastSeen.
 func UserSeen(ctx context.Context, db *sql.DB, user uid.ID, userIP string) error {
-	_, err := db.ExecContext(ctx, "UPDATE users SET last_seen = ?, last_seen_ip = ? WHERE id = ? AND deleted_at IS NULL", time.Now(), userIP, user)
+	now := time.Now()
+	// The assignments of an UPDATE statement are evaluated from left to right,
+	// so last_visit is set with the old value of last_seen.
+	_, err := db.ExecContext(ctx, `
+		UPDATE users SET last_visit = IF(last_seen < ?, last_seen, last_visit), last_seen = ?, last_seen_ip = ?
+		WHERE id = ? AND deleted_at IS NULL`, now.Add(-visitGap), now, userIP, user)
 	return err
 }
 
@@ -375,9 +375,13 @@ type request struct {
 	size   ImageSize // If zero, return the image without altering size.
 	fit    ImageFit
 	format ImageFormat // Should never be empty.
+	blur   bool        // Whether the image is blurred.
 	hash   []byte      // Incoming request hash value from the URL parameters.
 }
 
+// blurSigma is the standard deviation of the gaussian blur of blurred images.
+const blurSigma = 40
+
 func fromURL(u *url.URL) (_ *request, err error) {
 	r := &request{}
 	parts := strings.Split(u.Path, "/")
@@ -413,6 +417,7 @@ func fromURL(u *url.URL) (_ *request, err error) {
 	if !r.size.Zero() && r.fit == "" {
 		return nil, errors.New("zero size requires a non-empty image fit")
 	}
+	r.blur = query.Get("blur") == "true"
 
 	r.hash, err = base64.RawURLEncoding.DecodeString(query.Get("sig"))
 	if err != nil {
@@ -441,11 +446,16 @@ func (r *request) hashData() []byte {
 		fit = string(r.fit)
 	}
 	ext := r.format.Extension()
-	return []byte(id + size + fit + ext)
+	blur := ""
+	if r.blur {
+		blur = "blur"
+	}
+	return []byte(id + size + fit + ext + blur)
 }
 
 // filename returns a string of the format "{FileHash}_300x400_contain.jpeg"
-// used for storing images for caching purposes.
+// (or "{FileHash}_300x400_contain_blur.jpeg" for blurred images) used for
+// storing images for caching purposes.
 func (r *request) filename() string {
 	_, s := idToFolder(r.id)
 	if !r.size.Zero() {
@@ -458,6 +468,9 @@ func (r *request) filename() string {
 			s += "_" + string(r.fit)
 		}
 	}
+	if r.blur {
+		s += "_blur"
+	}
 	s += r.format.Extension()
 	return s
 }
@@ -470,6 +483,9 @@ func (r *request) url() string {
 		v.Set("size", r.size.String())
 		v.Set("fit", string(r.fit))
 	}
+	if r.blur {
+		v.Set("blur", "true")
+	}
 
 	if HMACKey != nil {
 		v.Set("sig", base64.RawURLEncoding.EncodeToString(r.computeHash()))
@@ -582,6 +598,9 @@ func getImage(ctx context.Context, db *sql.DB, r *request, cacheEnabled bool) ([
 	if r.format != "" && r.format != record.Format {
 		shouldProcess = true
 	}
+	if r.blur {
+		shouldProcess = true
+	}
 
 	if shouldProcess {
 		image, err = defaultConverter.convert(ctx, image, r)
@@ -706,6 +725,10 @@ func convertImage(image []byte, r *request) (_ []byte, err error) {
 		Crop:          true,
 	}
 
+	if r.blur {
+		o.GaussianBlur = bimg.GaussianBlur{Sigma: blurSigma}
+	}
+
 	if r.format != "" {
 		if o.Type, err = r.format.BIMGType(); err != nil {
 			return nil, fmt.Errorf("unsupported image format %v (image id: %v)", r.format, r.id)
@@ -759,7 +782,7 @@ type ImageOptions struct {
 func SaveImage(ctx context.Context, db *sql.DB, storeName string, file []byte, opts *ImageOptions) (*ImageRecord, error) {
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, nil
+		return nil, err
 	}
 
 	id, err := SaveImageTx(ctx, tx, storeName, file, opts)
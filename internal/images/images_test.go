@@ -35,6 +35,10 @@ func TestImageParamsFilename(t *testing.T) {
 			params:         request{id: zeroID, format: ImageFormatWEBP, fit: "cover"},
 			expectFilename: "13f149e737ec4063fc1d37aee9beabc4b4bbf.webp",
 		},
+		{
+			params:         request{id: zeroID, size: ImageSize{300, 400}, fit: ImageFitCover, format: ImageFormatJPEG, blur: true},
+			expectFilename: "13f149e737ec4063fc1d37aee9beabc4b4bbf_300x400_cover_blur.jpeg",
+		},
 	}
 	for _, item := range cases {
 		gotFilename := item.params.filename()
@@ -64,6 +68,19 @@ func TestFromURL(t *testing.T) {
 				hash:   []byte("haha"),
 			},
 		},
+		{
+			"/images/000000000000000000000000.jpeg?size=300x300&fit=contain&blur=true&sig=aGFoYQ",
+			false,
+			nil,
+			&request{
+				id:     zeroID,
+				size:   ImageSize{300, 300},
+				format: ImageFormatJPEG,
+				fit:    ImageFitContain,
+				blur:   true,
+				hash:   []byte("haha"),
+			},
+		},
 		{
 			"/images/000000000000000000000000.what?size=300x300&fit=contain&sig=aGFoYQ",
 			true,
@@ -275,6 +275,14 @@ func (m *Image) AppendCopy(name string, boxWidth, boxHeight int, fit ImageFit, f
 	return copy
 }
 
+// BlurCopies blurs all the copies of m (but not m itself).
+func (m *Image) BlurCopies() {
+	for _, c := range m.Copies {
+		c.Blur = true
+		c.SetURL()
+	}
+}
+
 // An ImageCopy is a transformed (size, format, and/or fit changed) copy of an
 // Image.
 type ImageCopy struct {
@@ -286,6 +294,7 @@ type ImageCopy struct {
 	BoxHeight int         `json:"boxHeight"`      // Height of the box the image fits into (for Format == ImageFitContain)
 	Fit       ImageFit    `json:"objectFit"`
 	Format    ImageFormat `json:"format"`
+	Blur      bool        `json:"blur,omitempty"`
 	URL       string      `json:"url"`
 }
 
@@ -296,6 +305,7 @@ func (c *ImageCopy) SetURL() {
 		size:   ImageSize{Width: c.BoxWidth, Height: c.BoxHeight},
 		fit:    c.Fit,
 		format: c.Format,
+		blur:   c.Blur,
 	}
 	c.URL = r.url()
 	if FullImageURL != nil {
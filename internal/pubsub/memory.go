@@ -0,0 +1,134 @@
+package pubsub
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrSlowSubscriber is the error of a MemoryBroker subscription that was closed
+// because its buffer of undelivered messages got full.
+var ErrSlowSubscriber = errors.New("pubsub: subscriber too slow")
+
+// memoryBufferSize is the number of undelivered messages a subscription of a
+// MemoryBroker may hold before it's closed.
+const memoryBufferSize = 256
+
+// MemoryBroker is a Broker that delivers messages only within the process. The
+// zero value is not usable; use NewMemoryBroker.
+type MemoryBroker struct {
+	mu     sync.Mutex
+	subs   map[string]map[*memorySubscription]struct{} // channel -> subscriptions
+	closed bool
+}
+
+// NewMemoryBroker returns a new MemoryBroker.
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		subs: make(map[string]map[*memorySubscription]struct{}),
+	}
+}
+
+// Publish implements Broker. Publish never blocks. Subscriptions that don't
+// keep up with the published messages are closed with ErrSlowSubscriber.
+func (b *MemoryBroker) Publish(channel string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+
+	for sub := range b.subs[channel] {
+		message := &Message{Channel: channel, Data: append([]byte(nil), data...)}
+		select {
+		case sub.messages <- message:
+		default:
+			b.closeSubscription(sub, ErrSlowSubscriber)
+		}
+	}
+	return nil
+}
+
+// Subscribe implements Broker.
+func (b *MemoryBroker) Subscribe(channels ...string) (Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	sub := &memorySubscription{
+		broker:   b,
+		channels: channels,
+		messages: make(chan *Message, memoryBufferSize),
+	}
+	for _, channel := range channels {
+		if b.subs[channel] == nil {
+			b.subs[channel] = make(map[*memorySubscription]struct{})
+		}
+		b.subs[channel][sub] = struct{}{}
+	}
+	return sub, nil
+}
+
+// Close implements Broker.
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	for _, subs := range b.subs {
+		for sub := range subs {
+			b.closeSubscription(sub, nil)
+		}
+	}
+	return nil
+}
+
+// closeSubscription removes sub from the broker and closes its messages
+// channel. b.mu must be held.
+func (b *MemoryBroker) closeSubscription(sub *memorySubscription, err error) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	sub.err = err
+	for _, channel := range sub.channels {
+		delete(b.subs[channel], sub)
+		if len(b.subs[channel]) == 0 {
+			delete(b.subs, channel)
+		}
+	}
+	close(sub.messages)
+}
+
+type memorySubscription struct {
+	broker   *MemoryBroker
+	channels []string
+	messages chan *Message
+
+	// Guarded by broker.mu.
+	closed bool
+	err    error
+}
+
+func (s *memorySubscription) Messages() <-chan *Message {
+	return s.messages
+}
+
+func (s *memorySubscription) Err() error {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	return s.err
+}
+
+func (s *memorySubscription) Close() error {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.closeSubscription(s, nil)
+	return nil
+}
@@ -0,0 +1,110 @@
+package pubsub
+
+import (
+	"testing"
+)
+
+func TestMemoryBrokerPublish(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Close()
+
+	sub1, err := b.Subscribe("a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub2, err := b.Subscribe("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		channel  string
+		data     string
+		wantSub1 bool
+		wantSub2 bool
+	}{
+		{"a", "one", true, false},
+		{"b", "two", true, true},
+		{"c", "three", false, false},
+	}
+	for _, item := range cases {
+		if err := b.Publish(item.channel, []byte(item.data)); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range []struct {
+			sub  Subscription
+			want bool
+		}{{sub1, item.wantSub1}, {sub2, item.wantSub2}} {
+			select {
+			case m := <-s.sub.Messages():
+				if !s.want {
+					t.Errorf("unexpected message %q on channel %s", m.Data, m.Channel)
+				} else if m.Channel != item.channel || string(m.Data) != item.data {
+					t.Errorf("expected %q on channel %s, got %q on channel %s", item.data, item.channel, m.Data, m.Channel)
+				}
+			default:
+				if s.want {
+					t.Errorf("expected %q on channel %s, got nothing", item.data, item.channel)
+				}
+			}
+		}
+	}
+}
+
+func TestMemoryBrokerClose(t *testing.T) {
+	b := NewMemoryBroker()
+
+	sub1, _ := b.Subscribe("a")
+	sub2, _ := b.Subscribe("a")
+
+	if err := sub1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub1.Close(); err != nil {
+		t.Fatalf("second close: %v", err)
+	}
+	if _, ok := <-sub1.Messages(); ok {
+		t.Error("expected the messages channel of a closed subscription to be closed")
+	}
+
+	if err := b.Publish("a", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if m := <-sub2.Messages(); string(m.Data) != "x" {
+		t.Errorf("expected x, got %q", m.Data)
+	}
+
+	b.Close()
+	if _, ok := <-sub2.Messages(); ok {
+		t.Error("expected the messages channel to be closed after closing the broker")
+	}
+	if err := b.Publish("a", nil); err != ErrClosed {
+		t.Errorf("expected ErrClosed publishing to a closed broker, got %v", err)
+	}
+	if _, err := b.Subscribe("a"); err != ErrClosed {
+		t.Errorf("expected ErrClosed subscribing to a closed broker, got %v", err)
+	}
+}
+
+func TestMemoryBrokerSlowSubscriber(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Close()
+
+	sub, _ := b.Subscribe("a")
+	for i := 0; i < memoryBufferSize+1; i++ {
+		if err := b.Publish("a", []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n := 0
+	for range sub.Messages() {
+		n++
+	}
+	if n != memoryBufferSize {
+		t.Errorf("expected %d buffered messages, got %d", memoryBufferSize, n)
+	}
+	if sub.Err() != ErrSlowSubscriber {
+		t.Errorf("expected ErrSlowSubscriber, got %v", sub.Err())
+	}
+}
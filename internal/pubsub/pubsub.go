@@ -0,0 +1,46 @@
+// Package pubsub implements publish-subscribe messaging, used by the realtime
+// features of the site (like chat). A Broker delivers the messages published to
+// a channel to all current subscribers of that channel.
+//
+// Two implementations are provided: RedisBroker, which works across multiple
+// server instances, and MemoryBroker, which works only within a single process
+// (for single node deployments and tests).
+package pubsub
+
+import "errors"
+
+// ErrClosed is returned when using a closed broker or subscription.
+var ErrClosed = errors.New("pubsub: closed")
+
+// Message is a message published to a channel.
+type Message struct {
+	Channel string
+	Data    []byte
+}
+
+// Broker publishes messages to channels and subscribes to them.
+type Broker interface {
+	// Publish sends data to all the subscribers of channel.
+	Publish(channel string, data []byte) error
+
+	// Subscribe returns a new subscription to channels.
+	Subscribe(channels ...string) (Subscription, error)
+
+	// Close closes the broker, and all its subscriptions.
+	Close() error
+}
+
+// Subscription is a subscription to one or more channels.
+type Subscription interface {
+	// Messages returns the channel on which the messages of the subscription
+	// are delivered. The channel is closed when the subscription is closed or
+	// when it fails, in which case Err returns a non-nil error.
+	Messages() <-chan *Message
+
+	// Err returns the error that caused the subscription to end, if any.
+	Err() error
+
+	// Close unsubscribes from all the channels of the subscription. It's safe
+	// to call Close multiple times.
+	Close() error
+}
@@ -0,0 +1,114 @@
+package pubsub
+
+import (
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// RedisBroker is a Broker that uses Redis Pub/Sub. Each subscription holds a
+// connection of its own.
+type RedisBroker struct {
+	pool *redis.Pool
+}
+
+// NewRedisBroker returns a new RedisBroker that gets its connections from pool.
+func NewRedisBroker(pool *redis.Pool) *RedisBroker {
+	return &RedisBroker{pool: pool}
+}
+
+// Publish implements Broker.
+func (b *RedisBroker) Publish(channel string, data []byte) error {
+	conn := b.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("PUBLISH", channel, data)
+	return err
+}
+
+// Subscribe implements Broker.
+func (b *RedisBroker) Subscribe(channels ...string) (Subscription, error) {
+	psc := redis.PubSubConn{Conn: b.pool.Get()}
+	args := make([]any, len(channels))
+	for i := range channels {
+		args[i] = channels[i]
+	}
+	if err := psc.Subscribe(args...); err != nil {
+		psc.Close()
+		return nil, err
+	}
+
+	sub := &redisSubscription{
+		psc:      psc,
+		messages: make(chan *Message),
+		done:     make(chan struct{}),
+	}
+	go sub.receive()
+	return sub, nil
+}
+
+// Close implements Broker. The connections are owned by the pool, so closing
+// the broker is a no-op; close the pool instead.
+func (b *RedisBroker) Close() error {
+	return nil
+}
+
+type redisSubscription struct {
+	psc      redis.PubSubConn
+	messages chan *Message
+
+	done      chan struct{} // Closed when Close is called.
+	closeOnce sync.Once
+
+	mu  sync.Mutex
+	err error
+}
+
+// receive delivers the messages received from Redis until the subscription is
+// closed or the connection fails.
+func (s *redisSubscription) receive() {
+	defer close(s.messages)
+
+	for {
+		switch v := s.psc.Receive().(type) {
+		case redis.Message:
+			select {
+			case s.messages <- &Message{Channel: v.Channel, Data: v.Data}:
+			case <-s.done:
+				return
+			}
+		case redis.Subscription:
+			if v.Count == 0 {
+				return // Unsubscribed from all channels.
+			}
+		case error:
+			select {
+			case <-s.done:
+			default:
+				s.mu.Lock()
+				s.err = v
+				s.mu.Unlock()
+			}
+			return
+		}
+	}
+}
+
+func (s *redisSubscription) Messages() <-chan *Message {
+	return s.messages
+}
+
+func (s *redisSubscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *redisSubscription) Close() (err error) {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.psc.Unsubscribe()
+		err = s.psc.Close()
+	})
+	return err
+}
@@ -0,0 +1,52 @@
+package ratelimits
+
+import (
+	"sync"
+	"time"
+)
+
+// memorySweepInterval is how often the expired buckets of a MemoryLimiter are
+// removed.
+const memorySweepInterval = time.Minute
+
+// MemoryLimiter is an in-process version of Limit, for when there's only one
+// instance of the server running. The zero value is ready to use.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+type memoryBucket struct {
+	tokens   int
+	reset    time.Time // Last time the bucket was filled.
+	interval time.Duration
+}
+
+// Limit is the same as the package level Limit, except that the buckets are
+// kept in memory.
+func (l *MemoryLimiter) Limit(bucketID string, interval time.Duration, maxTokens int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.buckets == nil {
+		l.buckets = make(map[string]*memoryBucket)
+	}
+	if now.Sub(l.lastSweep) >= memorySweepInterval {
+		for id, b := range l.buckets {
+			if now.Sub(b.reset) >= b.interval {
+				delete(l.buckets, id)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b := l.buckets[bucketID]
+	if b == nil || now.Sub(b.reset) >= interval {
+		b = &memoryBucket{tokens: maxTokens, reset: now, interval: interval}
+		l.buckets[bucketID] = b
+	}
+	b.tokens--
+	return b.tokens > -1
+}
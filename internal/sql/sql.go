@@ -324,6 +324,15 @@ func IsErrDuplicateErr(err error) bool {
 	return strings.Contains(err.Error(), "1062")
 }
 
+// IsErrRegexpErr reports whether err is the error the database returns for an
+// invalid regular expression.
+func IsErrRegexpErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	return strings.Contains(err.Error(), "1139")
+}
+
 // In question mark returns a string of the format
 // "(?, ?, ?)" where there are n question marks.
 // It panics if n <= 0.
@@ -16,6 +16,7 @@ import (
 	"github.com/discuitnet/discuit/cli/mod"
 	"github.com/discuitnet/discuit/cli/newbadge"
 	"github.com/discuitnet/discuit/cli/populatepost"
+	"github.com/discuitnet/discuit/cli/rebuildsearch"
 	"github.com/discuitnet/discuit/cli/serve"
 	"github.com/urfave/cli/v2"
 
@@ -40,6 +41,7 @@ func main() {
 			populatepost.Command,
 			forcepasschange.Command,
 			fixhotness.Command,
+			rebuildsearch.Command,
 			addalluserstocommunity.Command,
 			newbadge.Command,
 			deleteuser.Command,
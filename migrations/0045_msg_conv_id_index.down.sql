@@ -0,0 +1 @@
+alter table msg drop index idx_conv_id_id;
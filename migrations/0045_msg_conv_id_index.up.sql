@@ -0,0 +1 @@
+alter table msg add index idx_conv_id_id (conv_id, id);
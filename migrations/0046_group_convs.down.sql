@@ -0,0 +1,12 @@
+drop table if exists conv_participants;
+
+update convs set last_message = null where is_group = true;
+delete from msg where conv_id in (select id from convs where is_group = true);
+delete from convs where is_group = true;
+
+alter table msg modify column receiver_id binary (12) not null;
+
+alter table convs
+drop column title,
+drop column is_group,
+modify column user2_id binary (12) not null;
@@ -0,0 +1,42 @@
+alter table convs
+add column title varchar(255) null after id,
+add column is_group boolean not null default false after title,
+modify column user2_id binary (12) null;
+
+alter table msg modify column receiver_id binary (12) null;
+
+create table if not exists conv_participants (
+	conv_id binary (12) not null,
+	user_id binary (12) not null,
+	role enum ('owner', 'admin', 'member') not null default 'member',
+	joined_at datetime not null default current_timestamp(),
+	last_seen_at datetime null,
+	last_seen_msg binary (12) null,
+
+	primary key (conv_id, user_id),
+	foreign key (conv_id) references convs (id),
+	foreign key (user_id) references users (id),
+	index idx_user_id (user_id)
+);
+
+/* The starter of a one-to-one conversation (user1) is its owner. */
+insert into conv_participants (conv_id, user_id, role, joined_at, last_seen_at)
+select id, user1_id, 'owner', started_at, last_seen_by_user1 from convs;
+
+insert into conv_participants (conv_id, user_id, role, joined_at, last_seen_at)
+select id, user2_id, 'member', started_at, last_seen_by_user2 from convs where user2_id is not null;
+
+/*
+ * A participant has seen all the messages they received that are marked seen,
+ * and, if they've seen the conv since it was last updated, all its messages.
+ */
+update conv_participants
+set last_seen_msg = (
+	select max(msg.id) from msg
+	where msg.conv_id = conv_participants.conv_id and msg.receiver_id = conv_participants.user_id and msg.seen = true
+);
+
+update conv_participants
+inner join convs on convs.id = conv_participants.conv_id
+set conv_participants.last_seen_msg = convs.last_message
+where convs.last_message is not null and conv_participants.last_seen_at >= convs.last_updated;
@@ -0,0 +1,3 @@
+alter table msg
+drop column edited_at,
+drop column deleted_at;
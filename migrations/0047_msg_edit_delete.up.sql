@@ -0,0 +1,3 @@
+alter table msg
+add column edited_at datetime null after sent_at,
+add column deleted_at datetime null after edited_at;
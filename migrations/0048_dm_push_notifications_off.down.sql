@@ -0,0 +1 @@
+alter table users drop column dm_push_notifications_off;
@@ -0,0 +1 @@
+alter table users add column dm_push_notifications_off bool not null default false;
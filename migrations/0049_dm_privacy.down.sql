@@ -0,0 +1,7 @@
+drop table if exists conv_reports;
+
+alter table convs drop column status;
+
+alter table users
+drop column dm_privacy,
+drop column dm_min_points;
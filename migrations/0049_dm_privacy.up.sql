@@ -0,0 +1,21 @@
+alter table users
+add column dm_privacy tinyint not null default 0,
+add column dm_min_points int not null default 0;
+
+alter table convs add column status enum ('accepted', 'pending', 'declined') not null default 'accepted' after is_group;
+
+create table if not exists conv_reports (
+	id int unsigned not null auto_increment,
+	conv_id binary (12) not null,
+	reported_user binary (12) not null,
+	reason_id int unsigned not null,
+	created_by binary (12) not null,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	unique key (conv_id, created_by),
+	foreign key (conv_id) references convs (id),
+	foreign key (reported_user) references users (id),
+	foreign key (reason_id) references report_reasons (id),
+	foreign key (created_by) references users (id)
+);
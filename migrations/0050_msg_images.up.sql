@@ -0,0 +1,9 @@
+create table if not exists msg_images (
+	msg_id binary (12) not null,
+	image_id binary (12) not null,
+	position tinyint unsigned not null default 0,
+
+	primary key (msg_id, image_id),
+	foreign key (msg_id) references msg (id),
+	foreign key (image_id) references images (id)
+);
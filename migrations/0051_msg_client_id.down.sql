@@ -0,0 +1,3 @@
+alter table msg
+drop index uk_conv_sender_client_id,
+drop column client_id;
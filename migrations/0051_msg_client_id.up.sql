@@ -0,0 +1,3 @@
+alter table msg
+add column client_id varchar (64) null after sender_id,
+add unique key uk_conv_sender_client_id (conv_id, sender_id, client_id);
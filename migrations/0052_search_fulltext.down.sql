@@ -0,0 +1,4 @@
+alter table posts drop index ft_search;
+alter table comments drop index ft_search;
+alter table communities drop index ft_search;
+alter table users drop index ft_search;
@@ -0,0 +1,4 @@
+alter table posts add fulltext index ft_search (title, body);
+alter table comments add fulltext index ft_search (body);
+alter table communities add fulltext index ft_search (name, about);
+alter table users add fulltext index ft_search (username, about_me);
@@ -0,0 +1,26 @@
+create table if not exists custom_feeds (
+	id bigint unsigned not null auto_increment,
+	user_id binary (12) not null,
+	name varchar (128) not null, /* A unique identifier for each feed (per user). */
+	display_name varchar (128) not null,
+	description text,
+	public bool not null default false,
+	num_communities int not null default 0,
+	created_at datetime not null default current_timestamp(),
+	last_updated_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	unique (user_id, name),
+	foreign key (user_id) references users (id)
+) AUTO_INCREMENT = 100000;
+
+create table if not exists custom_feed_communities (
+	feed_id bigint unsigned not null,
+	community_id binary (12) not null,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (feed_id, community_id),
+	index (community_id),
+	foreign key (feed_id) references custom_feeds (id) on delete cascade,
+	foreign key (community_id) references communities (id) on delete cascade
+);
@@ -0,0 +1,12 @@
+create table if not exists muted_filters (
+    id bigint not null auto_increment,
+    user_id binary (12) not null,
+    filter_type enum ('keyword', 'regex', 'domain') not null,
+    value varchar (255) not null,
+    expires_at datetime,
+    created_at datetime not null default current_timestamp(),
+
+    primary key (id),
+    foreign key (user_id) references users (id),
+    unique (user_id, filter_type, value)
+);
@@ -0,0 +1,10 @@
+alter table posts
+drop index idx_rising,
+drop index idx_community_rising,
+drop index idx_controversy,
+drop index idx_community_controversy,
+drop index idx_best,
+drop index idx_community_best,
+drop column rising,
+drop column controversy,
+drop column best;
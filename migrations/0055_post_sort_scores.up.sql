@@ -0,0 +1,14 @@
+/*
+ * The values of these columns are set by the fix-hotness command (which runs
+ * core.UpdateAllPostsHotness), and it should be run after this migration.
+ */
+alter table posts
+add column rising bigint not null default 0 after hotness,
+add column controversy bigint not null default 0 after rising,
+add column best bigint not null default 0 after controversy,
+add index idx_rising (deleted, rising, id),
+add index idx_community_rising (deleted, community_id, rising, id),
+add index idx_controversy (deleted, controversy, id),
+add index idx_community_controversy (deleted, community_id, controversy, id),
+add index idx_best (deleted, best, id),
+add index idx_community_best (deleted, community_id, best, id);
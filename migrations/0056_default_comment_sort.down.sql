@@ -0,0 +1 @@
+alter table communities drop column default_comment_sort;
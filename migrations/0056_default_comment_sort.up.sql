@@ -0,0 +1 @@
+alter table communities add column default_comment_sort int not null default 0;
@@ -0,0 +1,7 @@
+alter table posts
+drop index idx_normalized_hotness,
+drop column normalized_hotness;
+
+alter table communities
+drop column hotness_config,
+drop column hotness_baseline;
@@ -0,0 +1,11 @@
+/*
+ * The hotness columns of posts are set by the fix-hotness command (which runs
+ * core.UpdateAllPostsHotness), and it should be run after this migration.
+ */
+alter table communities
+add column hotness_config json null,
+add column hotness_baseline double not null default 0;
+
+alter table posts
+add column normalized_hotness bigint not null default 0 after hotness,
+add index idx_normalized_hotness (deleted, normalized_hotness, id);
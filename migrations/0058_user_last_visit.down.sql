@@ -0,0 +1 @@
+alter table users drop column last_visit;
@@ -0,0 +1 @@
+alter table users add column last_visit datetime null after last_seen;
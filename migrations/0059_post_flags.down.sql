@@ -0,0 +1,5 @@
+alter table posts
+drop column nsfw,
+drop column spoiler;
+
+alter table users drop column nsfw_preference;
@@ -0,0 +1,5 @@
+alter table posts
+add column nsfw bool not null default false after body,
+add column spoiler bool not null default false after nsfw;
+
+alter table users add column nsfw_preference int not null default 0;
@@ -0,0 +1,7 @@
+alter table posts
+drop index idx_flair_id,
+drop column flair_id;
+
+alter table communities drop column flair_required;
+
+drop table if exists community_flairs;
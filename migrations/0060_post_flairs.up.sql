@@ -0,0 +1,18 @@
+create table if not exists community_flairs (
+	id int unsigned not null auto_increment,
+	community_id binary (12) not null,
+	text varchar(64) not null,
+	color varchar(7) not null,
+	created_by binary (12) not null,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	foreign key (community_id) references communities (id) on delete cascade,
+	foreign key (created_by) references users (id)
+);
+
+alter table communities add column flair_required bool not null default false after default_comment_sort;
+
+alter table posts
+add column flair_id int unsigned null after spoiler,
+add index idx_flair_id (flair_id, id);
@@ -0,0 +1,4 @@
+alter table posts
+drop index idx_crosspost_of,
+drop column crosspost_of,
+drop column no_crossposts;
@@ -0,0 +1,4 @@
+alter table posts
+add column crosspost_of binary (12) null after link_image,
+add column no_crossposts int unsigned not null default 0 after no_comments,
+add index idx_crosspost_of (crosspost_of, community_id);
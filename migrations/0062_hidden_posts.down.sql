@@ -0,0 +1,2 @@
+drop table if exists post_views;
+drop table if exists hidden_posts;
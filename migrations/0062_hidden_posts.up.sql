@@ -0,0 +1,21 @@
+create table if not exists hidden_posts (
+	id int unsigned not null auto_increment,
+	user_id binary (12) not null,
+	post_id binary (12) not null,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	unique key user_post (user_id, post_id),
+	foreign key (user_id) references users (id) on delete cascade,
+	foreign key (post_id) references posts (id) on delete cascade
+);
+
+create table if not exists post_views (
+	user_id binary (12) not null,
+	post_id binary (12) not null,
+	viewed_at datetime not null default current_timestamp(),
+
+	primary key (user_id, post_id),
+	foreign key (post_id) references posts (id) on delete cascade,
+	index idx_viewed_at (viewed_at)
+);
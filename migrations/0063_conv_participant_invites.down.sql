@@ -0,0 +1 @@
+alter table conv_participants drop column pending;
@@ -0,0 +1 @@
+alter table conv_participants add column pending boolean not null default false after role;
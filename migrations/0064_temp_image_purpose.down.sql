@@ -0,0 +1 @@
+alter table temp_images_2 drop column purpose;
@@ -0,0 +1 @@
+alter table temp_images_2 add column purpose tinyint not null default 0 after image_id;
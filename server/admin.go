@@ -68,6 +68,12 @@ func (s *Server) adminActions(w *responseWriter, r *request) error {
 		if err = comm.SetDefault(r.ctx, action == "add_default_forum"); err != nil {
 			return err
 		}
+	case "feed_cache_stats":
+		hits, misses, err := s.feedCacheStats()
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(map[string]int{"hits": hits, "misses": misses})
 	default:
 		return httperr.NewBadRequest("invalid_action", "Unsupported admin action.")
 	}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/pubsub"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/gorilla/websocket"
+)
+
+func TestChatFanOut(t *testing.T) {
+	s := &Server{broker: pubsub.NewMemoryBroker(), chat: newMemoryChatState()}
+	defer s.broker.Close()
+
+	conns := make(chan *chatConn, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		id, err := uid.FromString(r.URL.Query().Get("id"))
+		if err != nil {
+			t.Error(err)
+		}
+		user := &core.User{ID: id, Username: r.URL.Query().Get("user")}
+		c, err := s.newChatConn(user, ws)
+		if err != nil {
+			t.Error(err)
+			ws.Close()
+			return
+		}
+		conns <- c
+		c.run()
+	}))
+	defer ts.Close()
+
+	// dial opens a chat connection of user and returns the client side and
+	// the server side of it.
+	dial := func(user uid.ID, username string) (*websocket.Conn, *chatConn) {
+		url := "ws" + strings.TrimPrefix(ts.URL, "http") + "?user=" + username + "&id=" + user.String()
+		ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ws, <-conns
+	}
+
+	alice, bob := uid.New(), uid.New()
+	alice1, origin := dial(alice, "alice")
+	defer alice1.Close()
+	alice2, _ := dial(alice, "alice")
+	defer alice2.Close()
+	bob1, _ := dial(bob, "bob")
+	defer bob1.Close()
+	carol := uid.New()
+	carol1, _ := dial(carol, "carol")
+	defer carol1.Close()
+
+	presence, err := s.getChatPresence([]uid.ID{alice, bob, uid.New()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !presence[alice].Online || !presence[bob].Online {
+		t.Error("expected alice and bob to be online")
+	}
+
+	conv := &core.Convs{
+		ID:           uid.New(),
+		Participants: []*core.ConvParticipant{{UserID: alice}, {UserID: bob}, {UserID: carol, Pending: true}},
+	}
+	msg := &core.Message{ID: uid.New(), ConvID: conv.ID, SenderID: alice, Body: msql.NewNullString("Hello")}
+	s.publishMessage(conv, msg, origin.id)
+
+	for _, item := range []struct {
+		name string
+		ws   *websocket.Conn
+		want bool
+	}{
+		{"bob", bob1, true},
+		{"alice's other connection", alice2, true},
+		{"alice's sending connection", alice1, false},
+		{"carol (invited, not accepted)", carol1, false},
+	} {
+		item.ws.SetReadDeadline(time.Now().Add(time.Second))
+		got := &PingPong{}
+		err := item.ws.ReadJSON(got)
+		if !item.want {
+			if err == nil {
+				t.Errorf("%s: unexpected frame of type %q", item.name, got.Type)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", item.name, err)
+		} else if got.Type != pingPongNewMsg || got.Msg == nil || got.Msg.ID != msg.ID || got.Origin != "" {
+			t.Errorf("%s: got %+v, want the new message", item.name, got)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/pubsub"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Time allowed to write a frame to the client.
+	chatWriteWait = 10 * time.Second
+
+	// Time allowed to read the next pong from the client.
+	chatPongWait = 60 * time.Second
+
+	// Pings are sent with this period. Must be less than chatPongWait.
+	chatPingPeriod = (chatPongWait * 9) / 10
+
+	// Maximum size of a frame sent by the client.
+	chatMaxFrameSize = 64 << 10
+
+	// Number of frames that may be queued for a client before the connection
+	// is considered too slow and dropped.
+	chatSendBufferSize = 64
+
+	// How long a connection is considered alive, in the presence data, after
+	// its last heartbeat.
+	chatPresenceTTL = chatPongWait + chatWriteWait
+
+	// A message with the same body as the previous message sent by the same
+	// user to the same conv within this duration is rejected as a duplicate.
+	chatDuplicateWindow = 30 * time.Second
+)
+
+// chatConn is a single chat websocket connection. A user may have many chat
+// connections open at once (one for each device), each of them with its own
+// pub/sub subscription to the user's channel. Closing one of them does not
+// affect the others.
+type chatConn struct {
+	id   string // Unique among all connections.
+	s    *Server
+	user *core.User
+	ws   *websocket.Conn
+	sub  pubsub.Subscription
+
+	// Frames to be written to the client. All writes to ws happen in
+	// writePump.
+	send chan *PingPong
+
+	done      chan struct{} // Closed when the connection is closed.
+	closeOnce sync.Once
+}
+
+// newChatConn subscribes to the pub/sub channel of user and returns a new
+// chatConn. Call run to start serving the connection.
+func (s *Server) newChatConn(user *core.User, ws *websocket.Conn) (*chatConn, error) {
+	sub, err := s.broker.Subscribe(user.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	return &chatConn{
+		id:   uid.New().String(),
+		s:    s,
+		user: user,
+		ws:   ws,
+		sub:  sub,
+		send: make(chan *PingPong, chatSendBufferSize),
+		done: make(chan struct{}),
+	}, nil
+}
+
+// run serves the connection until it's closed. It blocks.
+func (c *chatConn) run() {
+	c.s.chatPresenceHeartbeat(c)
+	go c.receivePump()
+	go c.writePump()
+	c.readPump()
+}
+
+// close closes the connection, cleanly unsubscribing from the user's channel.
+// It's safe to call close multiple times and from multiple goroutines.
+func (c *chatConn) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if err := c.sub.Close(); err != nil {
+			log.Printf("Error unsubscribing chat connection: %v", err)
+		}
+		c.ws.Close()
+		c.s.chatPresenceDisconnected(c)
+	})
+}
+
+// sendPingPong queues message to be written to the client. If the queue is full
+// the connection is closed.
+func (c *chatConn) sendPingPong(message *PingPong) {
+	select {
+	case c.send <- message:
+	case <-c.done:
+	default:
+		log.Printf("Closing slow chat connection (user: %s)", c.user.Username)
+		c.close()
+	}
+}
+
+// readPump reads the frames sent by the client. The sender of every frame is
+// always the user the connection belongs to.
+func (c *chatConn) readPump() {
+	defer c.close()
+
+	c.ws.SetReadLimit(chatMaxFrameSize)
+	c.ws.SetReadDeadline(time.Now().Add(chatPongWait))
+	c.ws.SetPongHandler(func(string) error {
+		c.s.chatPresenceHeartbeat(c)
+		return c.ws.SetReadDeadline(time.Now().Add(chatPongWait))
+	})
+
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("Chat read error (user: %s): %v", c.user.Username, err)
+			}
+			return
+		}
+
+		// A malformed frame is rejected but doesn't close the connection.
+		frame := &chatFrame{}
+		if err := json.Unmarshal(data, frame); err != nil {
+			c.sendError(frame, errChatBadFrame)
+			continue
+		}
+
+		if err := c.s.handleChatFrame(c, frame); err != nil {
+			c.sendError(frame, err)
+		}
+	}
+}
+
+// receivePump forwards the messages published on the user's channel to the
+// client.
+func (c *chatConn) receivePump() {
+	defer c.close()
+
+	for m := range c.sub.Messages() {
+		message := &PingPong{}
+		if err := json.Unmarshal(m.Data, message); err != nil {
+			log.Printf("Error unmarshalling message: %v", err)
+			continue
+		}
+		if message.Origin == c.id {
+			continue // The client already knows.
+		}
+		message.Origin = ""
+		c.sendPingPong(message)
+	}
+	if err := c.sub.Err(); err != nil {
+		log.Printf("Chat subscription error (user: %s): %v", c.user.Username, err)
+	}
+}
+
+// writePump writes the queued frames, and periodic pings, to the client.
+func (c *chatConn) writePump() {
+	ticker := time.NewTicker(chatPingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.close()
+	}()
+
+	for {
+		select {
+		case message := <-c.send:
+			c.ws.SetWriteDeadline(time.Now().Add(chatWriteWait))
+			if err := c.ws.WriteJSON(message); err != nil {
+				log.Printf("Error writing message: %v, username: %s", err, c.user.Username)
+				return
+			}
+		case <-ticker.C:
+			c.ws.SetWriteDeadline(time.Now().Add(chatWriteWait))
+			if err := c.ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (s *Server) chatPresenceHeartbeat(c *chatConn) {
+	if err := s.chat.heartbeat(c.user.ID, c.id, chatPresenceTTL); err != nil {
+		log.Printf("Error updating chat presence: %v", err)
+	}
+}
+
+func (s *Server) chatPresenceDisconnected(c *chatConn) {
+	if err := s.chat.disconnected(c.user.ID, c.id); err != nil {
+		log.Printf("Error updating chat presence: %v", err)
+	}
+}
+
+// userPresence is the chat presence of a user.
+type userPresence struct {
+	Online       bool       `json:"online"` // If the user has at least one live chat connection.
+	LastActiveAt *time.Time `json:"lastActiveAt"`
+}
+
+// getChatPresence returns the chat presence of each of users.
+func (s *Server) getChatPresence(users []uid.ID) (map[uid.ID]*userPresence, error) {
+	return s.chat.presence(users)
+}
+
+// fillConvsPresence sets the presence fields of the participants of convs.
+func (s *Server) fillConvsPresence(convs ...*core.Convs) error {
+	var users []uid.ID
+	for _, conv := range convs {
+		for _, p := range conv.Participants {
+			users = append(users, p.UserID)
+		}
+	}
+	if len(users) == 0 {
+		return nil
+	}
+
+	presence, err := s.getChatPresence(users)
+	if err != nil {
+		return err
+	}
+	for _, conv := range convs {
+		for _, p := range conv.Participants {
+			if up := presence[p.UserID]; up != nil {
+				p.Online, p.LastActiveAt = up.Online, up.LastActiveAt
+			}
+		}
+	}
+	return nil
+}
+
+// sendError sends an error frame to the client telling it why frame was
+// rejected. Errors other than httperr.Error are logged and reported to the
+// client as internal server errors.
+func (c *chatConn) sendError(frame *chatFrame, err error) {
+	var httpErr *httperr.Error
+	if !errors.As(err, &httpErr) {
+		log.Printf("Error handling chat frame (type: %q, user: %s, conv: %v): %v", frame.Type, c.user.Username, frame.ConvID, err)
+		httpErr = &httperr.Error{
+			HTTPStatus: http.StatusInternalServerError,
+			Code:       "internal_server_error",
+			Message:    "Internal server error.",
+		}
+	}
+	c.sendPingPong(&PingPong{
+		Type: pingPongError,
+		Error: &chatError{
+			Error:     httpErr,
+			FrameType: frame.Type,
+			ConvID:    frame.ConvID,
+			MessageID: frame.MessageID,
+			ClientID:  frame.ClientID,
+		},
+	})
+}
+
+// sendAck sends an ack of msg, which was sent through the connection, to the
+// client.
+func (c *chatConn) sendAck(msg *core.Message) {
+	c.sendPingPong(&PingPong{
+		Type: pingPongAck,
+		Ack: &chatAck{
+			ClientID:  msg.ClientID.String,
+			ConvID:    msg.ConvID,
+			MessageID: msg.ID,
+			SentAt:    msg.SentAt,
+		},
+	})
+}
+
+var errChatBadFrame = httperr.NewBadRequest("chat/bad-frame", "Malformed frame.")
+
+var errChatRateLimited = &httperr.Error{
+	HTTPStatus: http.StatusTooManyRequests,
+	Code:       "chat/rate-limited",
+	Message:    "You're sending messages too fast. Slow down.",
+}
+
+// chatRateLimit takes a token from the rate limiting bucket bucketID and returns
+// errChatRateLimited if the bucket is empty.
+func (s *Server) chatRateLimit(bucketID string, interval time.Duration, maxTokens int) error {
+	if s.config.DisableRateLimits {
+		return nil
+	}
+	ok, err := s.chat.takeToken(bucketID, interval, maxTokens)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errChatRateLimited
+	}
+	return nil
+}
+
+// rateLimitChatFrame applies the per-user rate limits of chat to frame, sent by
+// user. It doesn't touch the database, so it's called before anything else is
+// done with frame.
+func (s *Server) rateLimitChatFrame(user uid.ID, frame *chatFrame) error {
+	if err := s.chatRateLimit("chat_frames_"+user.String(), time.Second*10, 50); err != nil {
+		return err
+	}
+	switch frame.Type {
+	case "":
+		if err := s.chatRateLimit("chat_msgs_1_"+user.String(), time.Second*10, 15); err != nil {
+			return err
+		}
+		return s.chatRateLimit("chat_msgs_2_"+user.String(), time.Hour*24, 3000)
+	case pingPongMsgEdited, pingPongMsgDeleted:
+		return s.chatRateLimit("chat_updates_"+user.String(), time.Second*10, 20)
+	}
+	return nil
+}
+
+// rateLimitChatConv applies the per-conv rate limits of chat to frame, sent to
+// conv.
+func (s *Server) rateLimitChatConv(conv uid.ID, frame *chatFrame) error {
+	if frame.Type == "" {
+		return s.chatRateLimit("chat_conv_msgs_"+conv.String(), time.Second*10, 40)
+	}
+	return nil
+}
+
+func chatMessageHash(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkDuplicateMessage returns an error if body is the same as the body of the
+// previous message sent by user to conv, given that it was sent within
+// chatDuplicateWindow (see rememberMessage).
+func (s *Server) checkDuplicateMessage(user, conv uid.ID, body string) error {
+	if body == "" {
+		return nil // Image only messages.
+	}
+
+	prev, err := s.chat.lastMessage(user, conv)
+	if err != nil {
+		return err
+	}
+	if prev == chatMessageHash(body) {
+		return httperr.NewBadRequest("chat/duplicate-message", "You just sent the same message.")
+	}
+	return nil
+}
+
+// rememberMessage records body as the body of the last message sent by user to
+// conv, for checkDuplicateMessage.
+func (s *Server) rememberMessage(user, conv uid.ID, body string) {
+	if err := s.chat.setLastMessage(user, conv, chatMessageHash(body), chatDuplicateWindow); err != nil {
+		log.Printf("Error remembering chat message: %v", err)
+	}
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/ratelimits"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/gomodule/redigo/redis"
+)
+
+// chatState holds the short-lived state of chat: the presence of users, the
+// rate limiting buckets of chat frames, and the last message sent by each user
+// to each conv (for rejecting duplicates). Like the pub/sub broker, it's kept
+// either in Redis or, for single instance deployments, in memory.
+type chatState interface {
+	// heartbeat marks the connection conn of user as alive for ttl, and the
+	// user as active now.
+	heartbeat(user uid.ID, conn string, ttl time.Duration) error
+
+	// disconnected removes the connection conn of user, and marks the user as
+	// active now.
+	disconnected(user uid.ID, conn string) error
+
+	// presence returns the presence of each of users.
+	presence(users []uid.ID) (map[uid.ID]*userPresence, error)
+
+	// takeToken takes a token from the rate limiting bucket bucketID (see
+	// ratelimits.Limit). It returns false if the bucket is empty.
+	takeToken(bucketID string, interval time.Duration, maxTokens int) (bool, error)
+
+	// lastMessage returns what was last stored with setLastMessage for user
+	// and conv, or the empty string if it expired.
+	lastMessage(user, conv uid.ID) (string, error)
+	setLastMessage(user, conv uid.ID, hash string, ttl time.Duration) error
+}
+
+// redisChatState is a chatState that's kept in Redis.
+type redisChatState struct {
+	pool *redis.Pool
+}
+
+// chatPresenceKey returns the Redis key of the sorted set of the chat
+// connections of user, scored by the time until which each is considered
+// alive.
+func chatPresenceKey(user uid.ID) string {
+	return "chat:presence:" + user.String()
+}
+
+// chatLastActiveKey returns the Redis key that holds the last time (a unix
+// timestamp) the user was active on chat.
+func chatLastActiveKey(user uid.ID) string {
+	return "chat:last_active:" + user.String()
+}
+
+// chatLastMessageKey returns the Redis key that holds the hash of the body of
+// the last message sent by user to conv.
+func chatLastMessageKey(user, conv uid.ID) string {
+	return "chat:last_msg:" + user.String() + ":" + conv.String()
+}
+
+func (s *redisChatState) heartbeat(user uid.ID, conn string, ttl time.Duration) error {
+	c := s.pool.Get()
+	defer c.Close()
+
+	now := time.Now()
+	key := chatPresenceKey(user)
+	c.Send("MULTI")
+	c.Send("ZADD", key, now.Add(ttl).Unix(), conn)
+	c.Send("ZREMRANGEBYSCORE", key, "-inf", now.Unix())
+	c.Send("EXPIRE", key, int(ttl.Seconds()))
+	c.Send("SET", chatLastActiveKey(user), now.Unix())
+	_, err := c.Do("EXEC")
+	return err
+}
+
+func (s *redisChatState) disconnected(user uid.ID, conn string) error {
+	c := s.pool.Get()
+	defer c.Close()
+
+	c.Send("MULTI")
+	c.Send("ZREM", chatPresenceKey(user), conn)
+	c.Send("SET", chatLastActiveKey(user), time.Now().Unix())
+	_, err := c.Do("EXEC")
+	return err
+}
+
+func (s *redisChatState) presence(users []uid.ID) (map[uid.ID]*userPresence, error) {
+	c := s.pool.Get()
+	defer c.Close()
+
+	now := time.Now().Unix()
+	for _, user := range users {
+		c.Send("ZCOUNT", chatPresenceKey(user), now, "+inf")
+		c.Send("GET", chatLastActiveKey(user))
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+
+	presence := make(map[uid.ID]*userPresence, len(users))
+	for _, user := range users {
+		p := &userPresence{}
+		count, err := redis.Int(c.Receive())
+		if err != nil {
+			return nil, err
+		}
+		p.Online = count > 0
+		ts, err := redis.Int64(c.Receive())
+		if err != nil && err != redis.ErrNil {
+			return nil, err
+		}
+		if err == nil {
+			t := time.Unix(ts, 0)
+			p.LastActiveAt = &t
+		}
+		presence[user] = p
+	}
+	return presence, nil
+}
+
+func (s *redisChatState) takeToken(bucketID string, interval time.Duration, maxTokens int) (bool, error) {
+	c, err := s.pool.Dial()
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+	return ratelimits.Limit(c, bucketID, interval, maxTokens)
+}
+
+func (s *redisChatState) lastMessage(user, conv uid.ID) (string, error) {
+	c := s.pool.Get()
+	defer c.Close()
+
+	hash, err := redis.String(c.Do("GET", chatLastMessageKey(user, conv)))
+	if err == redis.ErrNil {
+		err = nil
+	}
+	return hash, err
+}
+
+func (s *redisChatState) setLastMessage(user, conv uid.ID, hash string, ttl time.Duration) error {
+	c := s.pool.Get()
+	defer c.Close()
+
+	_, err := c.Do("SET", chatLastMessageKey(user, conv), hash, "EX", int(ttl.Seconds()))
+	return err
+}
+
+// memoryChatState is a chatState that's kept in memory. It works only if
+// there's a single instance of the server running. The zero value is not
+// usable; use newMemoryChatState.
+type memoryChatState struct {
+	limiter ratelimits.MemoryLimiter
+
+	mu           sync.Mutex
+	conns        map[uid.ID]map[string]time.Time // user -> connection -> alive until
+	lastActive   map[uid.ID]time.Time
+	lastMessages map[[2]uid.ID]memoryChatMessage // {user, conv} -> message
+	lastSweep    time.Time
+}
+
+type memoryChatMessage struct {
+	hash    string
+	expires time.Time
+}
+
+func newMemoryChatState() *memoryChatState {
+	return &memoryChatState{
+		conns:        make(map[uid.ID]map[string]time.Time),
+		lastActive:   make(map[uid.ID]time.Time),
+		lastMessages: make(map[[2]uid.ID]memoryChatMessage),
+	}
+}
+
+// sweep removes the connections and the messages that expired. s.mu must be
+// held.
+func (s *memoryChatState) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	for user, conns := range s.conns {
+		for conn, until := range conns {
+			if !until.After(now) {
+				delete(conns, conn)
+			}
+		}
+		if len(conns) == 0 {
+			delete(s.conns, user)
+		}
+	}
+	for key, msg := range s.lastMessages {
+		if !msg.expires.After(now) {
+			delete(s.lastMessages, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+func (s *memoryChatState) heartbeat(user uid.ID, conn string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	if s.conns[user] == nil {
+		s.conns[user] = make(map[string]time.Time)
+	}
+	s.conns[user][conn] = now.Add(ttl)
+	s.lastActive[user] = now
+	return nil
+}
+
+func (s *memoryChatState) disconnected(user uid.ID, conn string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns[user], conn)
+	if len(s.conns[user]) == 0 {
+		delete(s.conns, user)
+	}
+	s.lastActive[user] = time.Now()
+	return nil
+}
+
+func (s *memoryChatState) presence(users []uid.ID) (map[uid.ID]*userPresence, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	presence := make(map[uid.ID]*userPresence, len(users))
+	for _, user := range users {
+		p := &userPresence{}
+		for _, until := range s.conns[user] {
+			if until.After(now) {
+				p.Online = true
+				break
+			}
+		}
+		if t, ok := s.lastActive[user]; ok {
+			p.LastActiveAt = &t
+		}
+		presence[user] = p
+	}
+	return presence, nil
+}
+
+func (s *memoryChatState) takeToken(bucketID string, interval time.Duration, maxTokens int) (bool, error) {
+	return s.limiter.Limit(bucketID, interval, maxTokens), nil
+}
+
+func (s *memoryChatState) lastMessage(user, conv uid.ID) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg, ok := s.lastMessages[[2]uid.ID{user, conv}]
+	if !ok || !msg.expires.After(time.Now()) {
+		return "", nil
+	}
+	return msg.hash, nil
+}
+
+func (s *memoryChatState) setLastMessage(user, conv uid.ID, hash string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	s.lastMessages[[2]uid.ID{user, conv}] = memoryChatMessage{hash: hash, expires: now.Add(ttl)}
+	return nil
+}
@@ -32,24 +32,29 @@ func (s *Server) getComments(w *responseWriter, r *request) error {
 		return w.writeJSON(comments)
 	}
 
+	sort, err := s.commentSort(r, post)
+	if err != nil {
+		return err
+	}
+
 	var (
-		nextText   = query.Get("next")
-		nextPoints int
-		nextID     *uid.ID
+		nextText  = query.Get("next")
+		nextScore int
+		nextID    *uid.ID
 	)
 	if nextText != "" {
-		if nextPoints, nextID, err = core.NextPointsIDCursor(nextText); err != nil {
+		if nextScore, nextID, err = core.NextPointsIDCursor(nextText); err != nil {
 			return core.ErrInvalidFeedCursor
 		}
 	}
 	var cursor *core.CommentsCursor
 	if nextID != nil {
 		cursor = new(core.CommentsCursor)
-		cursor.Upvotes = nextPoints
+		cursor.Score = nextScore
 		cursor.NextID = *nextID
 	}
 
-	if _, err = post.GetComments(r.ctx, r.viewer, cursor); err != nil {
+	if _, err = post.GetComments(r.ctx, r.viewer, sort, cursor); err != nil {
 		return err
 	}
 
@@ -64,6 +69,20 @@ func (s *Server) getComments(w *responseWriter, r *request) error {
 	return w.writeJSON(res)
 }
 
+// commentSort returns the comment sort given in the sort query parameter of
+// the request, or, if there's none, the default comment sort of the community
+// of post.
+func (s *Server) commentSort(r *request, post *core.Post) (core.CommentSort, error) {
+	var sort core.CommentSort
+	if text := r.urlQueryParamsValue("sort"); text != "" {
+		if err := sort.UnmarshalText([]byte(text)); err != nil {
+			return sort, httperr.NewBadRequest("invalid_sort", "Invalid sort.")
+		}
+		return sort, nil
+	}
+	return post.DefaultCommentSort(r.ctx)
+}
+
 // /api/:commentID [GET]
 func (s *Server) getComment(w *responseWriter, r *request) error {
 	commentID, err := strToID(r.muxVar("commentID"))
@@ -149,6 +149,9 @@ func (s *Server) getCommunity(w *responseWriter, r *request) error {
 	if err = comm.FetchRules(r.ctx); err != nil {
 		return err
 	}
+	if err = comm.FetchFlairs(r.ctx); err != nil {
+		return err
+	}
 	if _, err = comm.Default(r.ctx); err != nil {
 		return err
 	}
@@ -191,16 +194,50 @@ func (s *Server) updateCommunity(w *responseWriter, r *request) error {
 		return err
 	}
 
-	rcomm := core.Community{}
+	rcomm := core.Community{
+		// Unchanged if omitted.
+		DefaultCommentSort: comm.DefaultCommentSort,
+		FlairRequired:      comm.FlairRequired,
+		HotnessConfig:      comm.HotnessConfig,
+	}
 	if err = r.unmarshalJSONBody(&rcomm); err != nil {
 		return err
 	}
 	comm.NSFW = rcomm.NSFW
 	comm.About = rcomm.About
+	comm.DefaultCommentSort = rcomm.DefaultCommentSort
+
+	hotnessChanged := !rcomm.HotnessConfig.Equal(comm.HotnessConfig)
+	if hotnessChanged {
+		// Only admins can change the hotness config. Checked before anything
+		// is saved so that the request doesn't partially succeed.
+		user, err := core.GetUser(r.ctx, s.db, *r.viewer, nil)
+		if err != nil {
+			return err
+		}
+		if !user.Admin {
+			return httperr.NewForbidden("not_admin", "You are not an admin.")
+		}
+		if rcomm.HotnessConfig != nil {
+			if err := rcomm.HotnessConfig.Validate(); err != nil {
+				return err
+			}
+		}
+	}
 
 	if err = comm.Update(r.ctx, *r.viewer); err != nil {
 		return err
 	}
+	if rcomm.FlairRequired != comm.FlairRequired {
+		if err = comm.SetFlairRequired(r.ctx, *r.viewer, rcomm.FlairRequired); err != nil {
+			return err
+		}
+	}
+	if hotnessChanged {
+		if err = comm.SetHotnessConfig(r.ctx, *r.viewer, rcomm.HotnessConfig); err != nil {
+			return err
+		}
+	}
 
 	return w.writeJSON(comm)
 }
@@ -480,6 +517,122 @@ func (s *Server) deleteCommunityRule(w *responseWriter, r *request) error {
 	return w.writeJSON(rule)
 }
 
+// /api/communities/{communityID}/flairs [GET]
+func (s *Server) getCommunityFlairs(w *responseWriter, r *request) error {
+	cid, err := strToID(r.muxVar("communityID"))
+	if err != nil {
+		return err
+	}
+
+	comm, err := core.GetCommunityByID(r.ctx, s.db, cid, r.viewer)
+	if err != nil {
+		return err
+	}
+	if err = comm.FetchFlairs(r.ctx); err != nil {
+		return err
+	}
+
+	return w.writeJSON(comm.Flairs)
+}
+
+// /api/communities/{communityID}/flairs [POST]
+func (s *Server) addCommunityFlair(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	cid, err := strToID(r.muxVar("communityID"))
+	if err != nil {
+		return err
+	}
+
+	comm, err := core.GetCommunityByID(r.ctx, s.db, cid, r.viewer)
+	if err != nil {
+		return err
+	}
+
+	req := core.CommunityFlair{}
+	if err := r.unmarshalJSONBody(&req); err != nil {
+		return err
+	}
+
+	flair, err := comm.AddFlair(r.ctx, req.Text, req.Color, *r.viewer)
+	if err != nil {
+		return err
+	}
+
+	return w.writeJSON(flair)
+}
+
+var errFlairNotFound = httperr.NewNotFound("flair-not-found", "Flair not found.")
+
+// getRequestFlair returns the flair of the URL variables communityID and
+// flairID. If the flair isn't of the community, errFlairNotFound is returned.
+func (s *Server) getRequestFlair(r *request) (*core.CommunityFlair, error) {
+	cid, err := strToID(r.muxVar("communityID"))
+	if err != nil {
+		return nil, err
+	}
+	flairID, err := strconv.Atoi(r.muxVar("flairID"))
+	if err != nil {
+		return nil, errFlairNotFound
+	}
+
+	flair, err := core.GetCommunityFlair(r.ctx, s.db, uint(flairID))
+	if err != nil {
+		return nil, err
+	}
+	if flair.CommunityID != cid {
+		return nil, errFlairNotFound
+	}
+	return flair, nil
+}
+
+// /api/communities/{communityID}/flairs/{flairID} [PUT]
+func (s *Server) updateCommunityFlair(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	flair, err := s.getRequestFlair(r)
+	if err != nil {
+		return err
+	}
+
+	req := core.CommunityFlair{}
+	if err := r.unmarshalJSONBody(&req); err != nil {
+		return err
+	}
+	flair.Text = req.Text
+	flair.Color = req.Color
+
+	if err = flair.Update(r.ctx, *r.viewer); err != nil {
+		return err
+	}
+
+	s.invalidateFeedCache(flair.CommunityID)
+	return w.writeJSON(flair)
+}
+
+// /api/communities/{communityID}/flairs/{flairID} [DELETE]
+func (s *Server) deleteCommunityFlair(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	flair, err := s.getRequestFlair(r)
+	if err != nil {
+		return err
+	}
+
+	if err = flair.Delete(r.ctx, *r.viewer); err != nil {
+		return err
+	}
+
+	s.invalidateFeedCache(flair.CommunityID)
+	return w.writeJSON(flair)
+}
+
 // /api/_report [POST]
 func (s *Server) report(w *responseWriter, r *request) error {
 	if !r.loggedIn {
@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -13,48 +15,244 @@ import (
 	"github.com/discuitnet/discuit/internal/httperr"
 	"github.com/discuitnet/discuit/internal/httputil"
 	"github.com/discuitnet/discuit/internal/uid"
-	"github.com/gomodule/redigo/redis"
 	"github.com/gorilla/websocket"
 )
 
+// The types of PingPong frames.
+const (
+	pingPongNewConv = "New Conv"
+	pingPongNewMsg  = "New Msg"
+	pingPongSeen    = "seen"
+	pingPongTyping  = "typing"
+
+	// Sent to the other participants of a conv when a message is edited or
+	// deleted. Clients send frames of the same types to edit or delete their
+	// messages.
+	pingPongMsgEdited  = "msg_edited"
+	pingPongMsgDeleted = "msg_deleted"
+
+	// Sent to all the participants of a group conv (including those just
+	// removed from it) whenever its participants or its title change.
+	pingPongConvUpdated = "conv_updated"
+	pingPongConvDeleted = "conv_deleted"
+	pingPongError       = "error"
+
+	// Sent only to the connection that sent a new message, once the message
+	// is persisted.
+	pingPongAck = "ack"
+
+	// Sent by clients, after reconnecting, to get the messages they missed.
+	// The response is a frame of the same type.
+	pingPongResync = "resync"
+)
+
+// PingPong is a frame sent to chat clients.
 type PingPong struct {
-	Type string        `json:"type"`
-	Msg  *core.Message `json:"msg"`
-	Conv *core.Convs   `json:"conv"`
+	Type   string         `json:"type"`
+	Msg    *core.Message  `json:"msg"`
+	Conv   *core.Convs    `json:"conv"`
+	Seen   *core.ConvSeen `json:"seen,omitempty"`
+	Typing *chatTyping    `json:"typing,omitempty"`
+	Error  *chatError     `json:"error,omitempty"`
+	Ack    *chatAck       `json:"ack,omitempty"`
+	Resync *chatResync    `json:"resync,omitempty"`
+
+	// The ID of the chat connection from which the event originated, if any.
+	// It's only used internally (it's cleared before frames are written to
+	// clients).
+	Origin string `json:"origin,omitempty"`
 }
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  4096,
-	WriteBufferSize: 4096,
+// chatTyping is a typing indicator. Typing indicators are only relayed to the
+// other participant of the conv and are never persisted.
+type chatTyping struct {
+	ConvID uid.ID `json:"convId"`
+	UserID uid.ID `json:"userId"`
+}
 
-	// We'll need to check the origin of our connection
-	// this will allow us to make requests from our React
-	// development server to here.
-	// For now, we'll do no checking and just allow any connection
-	CheckOrigin: func(r *http.Request) bool { return true },
+// chatError is sent to a chat client, in a frame of type pingPongError, when a
+// frame it sent is rejected.
+type chatError struct {
+	*httperr.Error
+
+	// The type, conv, and message (if any) of the rejected frame.
+	FrameType string  `json:"frameType"`
+	ConvID    uid.ID  `json:"convId"`
+	MessageID *uid.ID `json:"messageId,omitempty"`
+	ClientID  string  `json:"clientId,omitempty"`
 }
 
-func (s *Server) publishNewConv(c *core.Convs) {
-	conn := s.redisPool.Get()
-	defer conn.Close()
+// chatAck acknowledges that a new message sent by the client was persisted.
+// Resending a message with the same client ID yields the same ack.
+type chatAck struct {
+	ClientID  string    `json:"clientId"`
+	ConvID    uid.ID    `json:"convId"`
+	MessageID uid.ID    `json:"messageId"`
+	SentAt    time.Time `json:"sentAt"`
+}
 
-	message := PingPong{
-		Type: "New Conv",
-		Conv: c,
+// chatResync holds the messages requested with a resync frame, oldest first.
+// If More is true, there are more messages to fetch (after the last one of
+// Messages).
+type chatResync struct {
+	ConvID   *uid.ID         `json:"convId,omitempty"` // Nil if the messages are from all convs.
+	Messages []*core.Message `json:"messages"`
+	More     bool            `json:"more"`
+}
+
+// chatResyncLimit is the maximum number of messages in a resync frame.
+const chatResyncLimit = 200
+
+// chatFrame is a frame sent by chat clients.
+type chatFrame struct {
+	// One of the empty string (for a new message), pingPongSeen,
+	// pingPongTyping, pingPongMsgEdited, pingPongMsgDeleted, or
+	// pingPongResync.
+	Type string `json:"type"`
+
+	// For frames of type pingPongResync, ConvID is optional; if it's zero,
+	// the messages of all the convs of the user are returned.
+	ConvID uid.ID `json:"convId"`
+	Body   string `json:"body"`
+
+	// For new messages, an optional ID generated by the client. Sending a
+	// message with a client ID that was used before doesn't create a new
+	// message; the ack of the previous one is sent again instead.
+	ClientID string `json:"clientId"`
+
+	// For new messages, the images to attach to the message, uploaded
+	// beforehand to /api/users/{username}/convs/{convId}/images.
+	ImageIDs []uid.ID `json:"imageIds"`
+
+	// For frames of type pingPongSeen, the last message seen. If it's nil,
+	// all messages of the conv are marked as seen. For frames of type
+	// pingPongMsgEdited and pingPongMsgDeleted, the message to edit or delete.
+	// For frames of type pingPongResync, the last message the client has.
+	MessageID *uid.ID `json:"messageId"`
+}
+
+// newChatUpgrader returns the websocket upgrader used for chat connections.
+func (s *Server) newChatUpgrader() *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:  4096,
+		WriteBufferSize: 4096,
+		CheckOrigin:     s.checkChatOrigin,
+	}
+}
+
+// checkChatOrigin reports whether a chat websocket connection may be opened
+// from the origin of r. Requests with no Origin header (non-browser clients)
+// are allowed, since browsers always send one. Otherwise the origin must either
+// be the site's own or be listed in config.ChatAllowedOrigins.
+func (s *Server) checkChatOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
 	}
+	for _, allowed := range s.config.ChatAllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// publishPingPong sends message to all the chat connections of the user to.
+func (s *Server) publishPingPong(to uid.ID, message *PingPong) {
 	data, err := json.Marshal(message)
 	if err != nil {
 		log.Printf("Error marshalling message: %v", err)
 		return
 	}
 
-	// user2 is always the target user.
-	_, err = conn.Do("PUBLISH", c.User2ID.String(), data)
-	if err != nil {
+	if err := s.broker.Publish(to.String(), data); err != nil {
 		log.Printf("Error publishing message: %v", err)
 	}
 }
 
+// publishToConv sends message to all the participants of the conv, except for
+// the user except. Pending participants included, so it's only to be used for
+// invitations and changes to the conv itself (see publishToMembers).
+func (s *Server) publishToConv(c *core.Convs, except uid.ID, message *PingPong) {
+	for _, id := range c.ParticipantIDs(except) {
+		s.publishPingPong(id, message)
+	}
+}
+
+// publishToMembers sends message to all the participants of the conv who are
+// not pending, except for the user except.
+func (s *Server) publishToMembers(c *core.Convs, except uid.ID, message *PingPong) {
+	for _, id := range c.MemberIDs(except) {
+		s.publishPingPong(id, message)
+	}
+}
+
+// pushMessageToOfflineUsers sends a web push notification of msg to every
+// member of conv, other than the sender, who doesn't have a live chat
+// connection.
+func (s *Server) pushMessageToOfflineUsers(conv *core.Convs, msg *core.Message) {
+	receivers := conv.MemberIDs(msg.SenderID)
+	if len(receivers) == 0 {
+		return
+	}
+
+	presence, err := s.getChatPresence(receivers)
+	if err != nil {
+		log.Printf("Error getting chat presence: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, receiver := range receivers {
+		if p := presence[receiver]; p != nil && p.Online {
+			continue
+		}
+		if err := conv.SendMessagePushNotification(ctx, s.db, receiver, msg); err != nil {
+			log.Printf("Error sending message push notification: %v", err)
+		}
+	}
+}
+
+// publishToMembersAll sends message to all the members of the conv (see
+// publishToMembers), including all the chat connections of the user who caused
+// the event (so that the user's other devices stay in sync), except for the
+// connection with the ID origin. If origin is empty, no connection is skipped.
+func (s *Server) publishToMembersAll(c *core.Convs, origin string, message *PingPong) {
+	message.Origin = origin
+	s.publishToMembers(c, uid.ID{}, message)
+}
+
+// publishNewConv notifies all the participants of c, except for its creator,
+// about the new conv.
+func (s *Server) publishNewConv(c *core.Convs) {
+	s.publishToConv(c, c.User1ID, &PingPong{
+		Type: pingPongNewConv,
+		Conv: c,
+	})
+}
+
+// publishConvUpdated notifies all the participants of c, and the users in
+// removed, that c has changed.
+func (s *Server) publishConvUpdated(c *core.Convs, removed ...uid.ID) {
+	message := &PingPong{
+		Type: pingPongConvUpdated,
+		Conv: c,
+	}
+	s.publishToConv(c, uid.ID{}, message)
+	for _, id := range removed {
+		s.publishPingPong(id, message)
+	}
+}
+
 // /api/users/{username}/convs [GET, POST]
 func (s *Server) handleConvs(w *responseWriter, r *request) error {
 
@@ -81,36 +279,55 @@ func (s *Server) handleConvs(w *responseWriter, r *request) error {
 	// 	convs []*core.Convs	`json:"allConvs"`
 	// }{}
 
-	if r.req.Method == "POST" {
-		// Create a new convs.
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
 
-		if !r.loggedIn {
-			return errNotLoggedIn
-		}
+	if !userIsViewer {
+		return httperr.NewForbidden("not-your-conv", "Not your conversations.")
+	}
 
-		if !userIsViewer {
-			return httperr.NewForbidden("not-your-conv", "Not your conversations.")
+	if r.req.Method == "POST" {
+		if err := s.rateLimit(r, "new_convs_1_"+r.viewer.String(), time.Second*10, 1); err != nil {
+			return err
 		}
+		if err := s.rateLimit(r, "new_convs_2_"+r.viewer.String(), time.Hour*24, 20); err != nil {
+			return err
+		}
+
+		// Create a new convs. If targetIds is set, a group conv is created
+		// with title as its title.
 
 		form := struct {
-			StarterID uid.ID `json:"starterId"` // starter is the same user as the user
-			TargetID  uid.ID `json:"targetId"`
+			StarterID uid.ID   `json:"starterId"` // starter is the same user as the user
+			TargetID  uid.ID   `json:"targetId"`
+			TargetIDs []uid.ID `json:"targetIds"`
+			Title     string   `json:"title"`
 		}{}
 		if err := r.unmarshalJSONBody(&form); err != nil {
 			return err
 		}
 
-		targetUser, err := core.GetUser(r.ctx, s.db, form.TargetID, &form.TargetID)
-		if err != nil {
-			return err
+		var conv *core.Convs
+		if len(form.TargetIDs) > 0 {
+			members, err := core.GetUsersByIDs(r.ctx, s.db, form.TargetIDs, r.viewer)
+			if err != nil {
+				return err
+			}
+			if conv, err = core.CreateGroupConv(r.ctx, s.db, user, form.Title, members); err != nil {
+				return err
+			}
+		} else {
+			targetUser, err := core.GetUser(r.ctx, s.db, form.TargetID, &form.TargetID)
+			if err != nil {
+				return err
+			}
+			if conv, err = core.CreateConv(r.ctx, s.db, user, targetUser); err != nil {
+				return err
+			}
 		}
 
-		conv, err := core.CreateConv(r.ctx, s.db, user, targetUser)
-
-		if err != nil {
-			return err
-		}
-		// notify the target user about the new conv.
+		// notify the target users about the new conv.
 		s.publishNewConv(conv)
 
 		w.writeJSON(conv)
@@ -121,152 +338,527 @@ func (s *Server) handleConvs(w *responseWriter, r *request) error {
 	if err != nil {
 		return err
 	}
+	if err = s.fillConvsPresence(convs...); err != nil {
+		return err
+	}
 
 	w.writeJSON(convs)
 	return nil
 }
 
 // /api/users/{username}/convs/{convId} [GET]
+//
+// Returns a page of the messages of the conv. The URL query parameters before
+// and after are the pagination cursors returned by a previous request; around
+// is the ID of a message to jump to.
 func (s *Server) handleConvMessages(w *responseWriter, r *request) error {
-	convIdStr := r.muxVar("convId")
-	convId, err := uid.FromString(convIdStr)
+	conv, err := s.getViewerConv(r)
 	if err != nil {
 		return err
 	}
-	msgs, err := core.GetConvMessages(r.ctx, s.db, convId)
+
+	query := r.urlQueryParams()
+	opts := &core.MessagesOptions{}
+	if opts.Limit, err = getFeedLimit(query, s.config.PaginationLimit, s.config.PaginationLimitMax); err != nil {
+		return err
+	}
+	if opts.Before, err = core.ParseMessagesCursor(query.Get("before")); err != nil {
+		return err
+	}
+	if opts.After, err = core.ParseMessagesCursor(query.Get("after")); err != nil {
+		return err
+	}
+	if opts.Around, err = core.ParseMessagesCursor(query.Get("around")); err != nil {
+		return err
+	}
+	n := 0
+	for _, cursor := range []*uid.ID{opts.Before, opts.After, opts.Around} {
+		if cursor != nil {
+			n++
+		}
+	}
+	if n > 1 {
+		return httperr.NewBadRequest("invalid_cursor", "Only one of before, after, and around may be set.")
+	}
+
+	set, err := core.GetConvMessages(r.ctx, s.db, conv.ID, opts)
 	if err != nil {
 		return err
 	}
+	return w.writeJSON(set)
+}
 
-	w.writeJSON(msgs)
-	return nil
+// /api/users/{username}/convs/{convId}/messages/{messageId} [PUT, DELETE]
+func (s *Server) handleConvMessage(w *responseWriter, r *request) error {
+	conv, err := s.getViewerConv(r)
+	if err != nil {
+		return err
+	}
+	msgID, err := strToID(r.muxVar("messageId"))
+	if err != nil {
+		return err
+	}
+	if err := s.rateLimitUpdateContent(r, *r.viewer); err != nil {
+		return err
+	}
+
+	var (
+		msg      *core.Message
+		pingType string
+	)
+	if r.req.Method == "PUT" {
+		form := struct {
+			Body string `json:"body"`
+		}{}
+		if err := r.unmarshalJSONBody(&form); err != nil {
+			return err
+		}
+		msg, err = conv.EditMessage(r.ctx, s.db, *r.viewer, msgID, form.Body)
+		pingType = pingPongMsgEdited
+	} else {
+		msg, err = conv.DeleteMessage(r.ctx, s.db, *r.viewer, msgID)
+		pingType = pingPongMsgDeleted
+	}
+	if err != nil {
+		return err
+	}
+
+	s.publishToMembersAll(conv, "", &PingPong{Type: pingType, Msg: msg})
+	return w.writeJSON(msg)
 }
 
-// /api/users/{username}/conn [GET]
-func (s *Server) handleChat(w *responseWriter, r *request) error {
-	wupgrade := w.w
-	gzipResponseWriter, ok := wupgrade.(httputil.GzipResponseWriter)
-	if !ok {
-		return errors.New("Response Writer is not GzipResponseWriter.")
+// getViewerConv returns the conv with the ID in the convId route variable. It
+// returns an error if the viewer is not the user in the username route variable
+// or if the viewer is not a participant of the conv.
+func (s *Server) getViewerConv(r *request) (*core.Convs, error) {
+	if !r.loggedIn {
+		return nil, errNotLoggedIn
 	}
 
-	r.req.Header.Del("Sec-WebSocket-Extensions")
-	username := r.muxVar("username")
-	user, err := core.GetUserByUsername(r.ctx, s.db, username, r.viewer)
+	user, err := core.GetUserByUsername(r.ctx, s.db, r.muxVar("username"), r.viewer)
+	if err != nil {
+		return nil, err
+	}
+	if user.ID != *r.viewer {
+		return nil, httperr.NewForbidden("not-your-conv", "Not your conversations.")
+	}
+
+	convId, err := strToID(r.muxVar("convId"))
+	if err != nil {
+		return nil, err
+	}
+	conv, err := core.GetConvID(r.ctx, s.db, uid.NullID{ID: convId, Valid: true})
+	if err != nil {
+		return nil, err
+	}
+	if !conv.HasParticipant(user.ID) {
+		return nil, httperr.NewForbidden("not-your-conv", "Not your conversation.")
+	}
+	return conv, nil
+}
+
+// /api/users/{username}/convs/{convId} [DELETE]
+func (s *Server) deleteConv(w *responseWriter, r *request) error {
+	conv, err := s.getViewerConv(r)
 	if err != nil {
 		return err
 	}
 
-	// upgrade the connection
-	ws, err := upgrader.Upgrade(gzipResponseWriter.ResponseWriter, r.req, nil)
+	if err := conv.Delete(r.ctx, s.db, *r.viewer); err != nil {
+		return err
+	}
+	s.publishToConv(conv, uid.ID{}, &PingPong{Type: pingPongConvDeleted, Conv: conv})
+	return w.writeJSON(conv)
+}
+
+// /api/users/{username}/convs/{convId}/images [POST]
+//
+// Uploads an image to be attached to a message sent afterwards (see
+// chatFrame.ImageIDs).
+func (s *Server) uploadConvImage(w *responseWriter, r *request) error {
+	if _, err := s.getViewerConv(r); err != nil {
+		return err
+	}
+
+	if err := s.rateLimit(r, "msg_uploads_1_"+r.viewer.String(), time.Second*2, 1); err != nil {
+		return err
+	}
+	if err := s.rateLimit(r, "msg_uploads_2_"+r.viewer.String(), time.Hour*24, 100); err != nil {
+		return err
+	}
+
+	r.req.Body = http.MaxBytesReader(w, r.req.Body, int64(s.config.MaxImageSize)) // limit max upload size
+	if err := r.req.ParseMultipartForm(int64(s.config.MaxImageSize)); err != nil {
+		return httperr.NewBadRequest("file_size_exceeded", "Max file size exceeded.")
+	}
+
+	file, _, err := r.req.FormFile("image")
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 
-	// starting go routines to read user's messages and to listen to messages froms others.
-	go s.writeMessages(user, ws)
-	go s.readMessages(user, ws)
-	return nil
+	fileData, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	image, err := core.SaveMessageImage(r.ctx, s.db, *r.viewer, fileData)
+	if err != nil {
+		return err
+	}
+
+	return w.writeJSON(image)
 }
 
-// writeMessages creates a redis subscription pool where users can send messages.
-// Then it listens for messages sent to it so that it can send them back to the user.
-func (s *Server) writeMessages(user *core.User, conn *websocket.Conn) {
-	rconn := s.redisPool.Get()
-	defer conn.Close()
+// /api/users/{username}/convs/{convId} [PUT]
+func (s *Server) updateConv(w *responseWriter, r *request) error {
+	conv, err := s.getViewerConv(r)
+	if err != nil {
+		return err
+	}
 
-	psc := redis.PubSubConn{Conn: rconn}
-	psc.Subscribe(user.ID.String())
+	form := struct {
+		Title string `json:"title"`
+	}{}
+	if err := r.unmarshalJSONBody(&form); err != nil {
+		return err
+	}
 
-	for {
-		switch v := psc.Receive().(type) {
-		case redis.Message:
+	if err := conv.SetTitle(r.ctx, s.db, *r.viewer, form.Title); err != nil {
+		return err
+	}
+	s.publishConvUpdated(conv)
+	return w.writeJSON(conv)
+}
 
-			message := PingPong{}
-			err := json.Unmarshal(v.Data, &message)
-			if err != nil {
-				log.Printf("Error unmarshalling message: %v", err)
-				break
-			}
+// /api/users/{username}/convs/requests [GET]
+//
+// Returns the pending message requests sent to the user.
+func (s *Server) getConvRequests(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
 
-			err = conn.WriteJSON(message)
-			if err != nil {
-				log.Printf("Error writing message: %v, username: %s", err, user.Username)
-				break
-			}
-		case error:
-			log.Printf("Error: %v", v)
-			return
+	user, err := core.GetUserByUsername(r.ctx, s.db, r.muxVar("username"), r.viewer)
+	if err != nil {
+		return err
+	}
+	if user.ID != *r.viewer {
+		return httperr.NewForbidden("not-your-conv", "Not your conversations.")
+	}
+
+	convs, err := core.GetUsersConvRequests(r.ctx, s.db, user.ID)
+	if err != nil {
+		return err
+	}
+	if err = s.fillConvsPresence(convs...); err != nil {
+		return err
+	}
+	return w.writeJSON(convs)
+}
+
+// /api/users/{username}/convs/{convId}/request [POST]
+//
+// Accepts, declines, or reports a message request (or an invitation to a group
+// conv), depending on the URL query parameter action. For reports, the request
+// body is of the form {"reason": <report reason ID>}.
+func (s *Server) handleConvRequest(w *responseWriter, r *request) error {
+	conv, err := s.getViewerConv(r)
+	if err != nil {
+		return err
+	}
+
+	switch r.urlQueryParams().Get("action") {
+	case "accept":
+		err = conv.AcceptRequest(r.ctx, s.db, *r.viewer)
+	case "decline":
+		err = conv.DeclineRequest(r.ctx, s.db, *r.viewer)
+	case "report":
+		if err = s.rateLimit(r, "reporting_1_"+r.viewer.String(), time.Second*5, 1); err != nil {
+			return err
 		}
+		form := struct {
+			Reason int `json:"reason"`
+		}{}
+		if err = r.unmarshalJSONBody(&form); err != nil {
+			return err
+		}
+		err = conv.ReportRequest(r.ctx, s.db, *r.viewer, form.Reason)
+	default:
+		return httperr.NewBadRequest("invalid_action", "Unsupported action.")
 	}
+	if err != nil {
+		return err
+	}
+
+	s.publishConvUpdated(conv)
+	return w.writeJSON(conv)
 }
 
-// readMessages reads the messages sent by the user. It saves them to the database before
-// publishing them to the appropriate target. If there's an error while reading the connection
-// we end the this function and send an ending message to writeMessages so that it can end as well.
-func (s *Server) readMessages(user *core.User, conn *websocket.Conn) {
-	for {
-		msgTemp := &struct {
-			ConvID     uid.ID `json:"convId"`
-			SenderID   uid.ID `json:"senderId"`
-			ReceiverID uid.ID `json:"receiverId"`
-			Body       string `json:"body"`
+// /api/users/{username}/convs/{convId}/participants [GET, POST]
+func (s *Server) handleConvParticipants(w *responseWriter, r *request) error {
+	conv, err := s.getViewerConv(r)
+	if err != nil {
+		return err
+	}
+
+	if r.req.Method == "POST" {
+		form := struct {
+			UserID uid.ID `json:"userId"`
 		}{}
-		err := conn.ReadJSON(&msgTemp)
+		if err := r.unmarshalJSONBody(&form); err != nil {
+			return err
+		}
+		user, err := core.GetUser(r.ctx, s.db, form.UserID, r.viewer)
 		if err != nil {
-			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
-				log.Println("connection closed by client:", err)
-			} else {
-				log.Println("read error:", err)
-			}
+			return err
+		}
+		if err := conv.AddParticipant(r.ctx, s.db, *r.viewer, user); err != nil {
+			return err
+		}
+		s.publishPingPong(user.ID, &PingPong{Type: pingPongNewConv, Conv: conv})
+		s.publishConvUpdated(conv)
+	}
+
+	return w.writeJSON(conv.Participants)
+}
+
+// /api/users/{username}/convs/{convId}/participants/{userId} [PUT, DELETE]
+//
+// A PUT request changes the role of the participant. A DELETE request removes
+// the participant from the conv; when the participant is the viewer, the viewer
+// leaves the conv.
+func (s *Server) handleConvParticipant(w *responseWriter, r *request) error {
+	conv, err := s.getViewerConv(r)
+	if err != nil {
+		return err
+	}
+	userID, err := strToID(r.muxVar("userId"))
+	if err != nil {
+		return err
+	}
 
-			// This will cause an error in writeMessages since the msg is not json encoded
-			// Since its an error we end the that go routine alongside this one.
-			s.publishEndMessage(user.ID, []byte("End"))
-			break
+	if r.req.Method == "PUT" {
+		form := struct {
+			Role core.ConvRole `json:"role"`
+		}{}
+		if err := r.unmarshalJSONBody(&form); err != nil {
+			return err
+		}
+		if err := conv.SetParticipantRole(r.ctx, s.db, *r.viewer, userID, form.Role); err != nil {
+			return err
 		}
-		// Create a new context for the database operation
-		ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
-		defer cancel()
+		s.publishConvUpdated(conv)
+	} else {
+		if err := conv.RemoveParticipant(r.ctx, s.db, *r.viewer, userID); err != nil {
+			return err
+		}
+		s.publishConvUpdated(conv, userID)
+	}
+
+	return w.writeJSON(conv)
+}
 
-		msg, err := core.CreateMessage(ctx, s.db, msgTemp.ConvID, msgTemp.SenderID, msgTemp.ReceiverID, msgTemp.Body)
+// /api/users/{username}/presence [GET]
+//
+// Returns the chat presence of the user. Only users who share a conv with the
+// user can see it.
+func (s *Server) getUserPresence(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	user, err := core.GetUserByUsername(r.ctx, s.db, r.muxVar("username"), r.viewer)
+	if err != nil {
+		return err
+	}
+	if user.ID != *r.viewer {
+		shared, err := core.UsersShareConv(r.ctx, s.db, *r.viewer, user.ID)
 		if err != nil {
-			log.Printf("Error saving message: %v", err)
-			return
+			return err
+		}
+		if !shared {
+			return httperr.NewForbidden("no-shared-conv", "You don't have a conversation with this user.")
 		}
-		s.publishMessage(msg)
+	}
 
+	presence, err := s.getChatPresence([]uid.ID{user.ID})
+	if err != nil {
+		return err
 	}
+	return w.writeJSON(presence[user.ID])
 }
 
-// publishMessage sends the given message to the receiver
-func (s *Server) publishMessage(msg *core.Message) {
-	conn := s.redisPool.Get()
-	defer conn.Close()
+// /api/users/{username}/conn [GET]
+func (s *Server) handleChat(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
 
-	message := PingPong{
-		Type: "New Msg",
-		Msg:  msg,
+	wupgrade := w.w
+	gzipResponseWriter, ok := wupgrade.(httputil.GzipResponseWriter)
+	if !ok {
+		return errors.New("Response Writer is not GzipResponseWriter.")
 	}
-	data, err := json.Marshal(&message)
+
+	r.req.Header.Del("Sec-WebSocket-Extensions")
+	username := r.muxVar("username")
+	user, err := core.GetUserByUsername(r.ctx, s.db, username, r.viewer)
 	if err != nil {
-		log.Printf("Error marshalling message: %v", err)
-		return
+		return err
+	}
+	if user.ID != *r.viewer {
+		return httperr.NewForbidden("not-your-conn", "Not your chat connection.")
+	}
+	if user.Banned {
+		return httperr.NewForbidden("account_suspended", "User account suspended.")
 	}
 
-	_, err = conn.Do("PUBLISH", msg.ReceiverID.String(), data)
+	// upgrade the connection
+	ws, err := s.chatUpgrader.Upgrade(gzipResponseWriter.ResponseWriter, r.req, nil)
 	if err != nil {
-		log.Printf("Error publishing message: %v", err)
+		return err
+	}
+
+	conn, err := s.newChatConn(user, ws)
+	if err != nil {
+		ws.Close()
+		return err
 	}
+	go conn.run()
+	return nil
 }
 
-// publishEndMessage is a variation to send a non-json encoded message.
-func (s *Server) publishEndMessage(recieverId uid.ID, msg []byte) {
-	conn := s.redisPool.Get()
-	defer conn.Close()
+// handleChatFrame acts on a single frame sent through the connection c. Frames
+// to convs the user is not a participant of, or messages to users who muted the
+// user, are dropped.
+func (s *Server) handleChatFrame(c *chatConn, frame *chatFrame) error {
+	user := c.user
+	if err := s.rateLimitChatFrame(user.ID, frame); err != nil {
+		return err
+	}
 
-	_, err := conn.Do("PUBLISH", recieverId.String(), msg)
+	// Create a new context for the database operation
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	if frame.Type == pingPongResync && frame.ConvID.Zero() {
+		if frame.MessageID == nil {
+			return httperr.NewBadRequest("chat/no-message-id", "Message ID required.")
+		}
+		msgs, more, err := core.GetUserMessagesAfter(ctx, s.db, user.ID, *frame.MessageID, chatResyncLimit)
+		if err != nil {
+			return err
+		}
+		c.sendPingPong(&PingPong{Type: pingPongResync, Resync: &chatResync{Messages: msgs, More: more}})
+		return nil
+	}
+
+	conv, err := core.GetConvID(ctx, s.db, uid.NullID{ID: frame.ConvID, Valid: true})
 	if err != nil {
-		log.Printf("Error publishing message: %v", err)
+		return err
+	}
+	if !conv.HasParticipant(user.ID) {
+		return httperr.NewForbidden("conv/not-participant", "Not a participant of this conversation.")
+	}
+	if err := s.rateLimitChatConv(conv.ID, frame); err != nil {
+		return err
+	}
+
+	switch frame.Type {
+	case "":
+		if frame.ClientID != "" {
+			// The client might be resending a message it didn't get an ack
+			// of.
+			msg, err := conv.MessageByClientID(ctx, s.db, user.ID, frame.ClientID)
+			if err != nil {
+				return err
+			}
+			if msg != nil {
+				c.sendAck(msg)
+				return nil
+			}
+		}
+		if err := s.checkDuplicateMessage(user.ID, conv.ID, frame.Body); err != nil {
+			return err
+		}
+		wasRequest := conv.IsRequest()
+		msg, err := conv.SendMessage(ctx, s.db, user.ID, frame.Body, frame.ImageIDs, frame.ClientID)
+		if err == core.ErrMessageExists {
+			// The same message was sent concurrently (through another
+			// connection, for instance) and the other send won.
+			if msg, err = conv.MessageByClientID(ctx, s.db, user.ID, frame.ClientID); err != nil {
+				return err
+			}
+			if msg != nil {
+				c.sendAck(msg)
+				return nil
+			}
+			return core.ErrMessageExists
+		}
+		if err != nil {
+			return err
+		}
+		c.sendAck(msg)
+		s.rememberMessage(user.ID, conv.ID, frame.Body)
+		if wasRequest && !conv.IsRequest() {
+			s.publishConvUpdated(conv)
+		}
+		s.publishMessage(conv, msg, c.id)
+		go s.pushMessageToOfflineUsers(conv, msg)
+	case pingPongResync:
+		if frame.MessageID == nil {
+			return httperr.NewBadRequest("chat/no-message-id", "Message ID required.")
+		}
+		set, err := core.GetConvMessages(ctx, s.db, conv.ID, &core.MessagesOptions{
+			After: frame.MessageID,
+			Limit: chatResyncLimit,
+		})
+		if err != nil {
+			return err
+		}
+		c.sendPingPong(&PingPong{
+			Type:   pingPongResync,
+			Resync: &chatResync{ConvID: &conv.ID, Messages: set.Messages, More: set.After != ""},
+		})
+	case pingPongSeen:
+		seen, err := conv.MarkSeen(ctx, s.db, user.ID, frame.MessageID)
+		if err != nil {
+			return err
+		}
+		s.publishToMembersAll(conv, c.id, &PingPong{Type: pingPongSeen, Seen: seen})
+	case pingPongTyping:
+		s.publishToMembers(conv, user.ID, &PingPong{
+			Type:   pingPongTyping,
+			Typing: &chatTyping{ConvID: conv.ID, UserID: user.ID},
+		})
+	case pingPongMsgEdited, pingPongMsgDeleted:
+		if frame.MessageID == nil {
+			return httperr.NewBadRequest("no_message_id", "No message ID.")
+		}
+		var msg *core.Message
+		if frame.Type == pingPongMsgEdited {
+			msg, err = conv.EditMessage(ctx, s.db, user.ID, *frame.MessageID, frame.Body)
+		} else {
+			msg, err = conv.DeleteMessage(ctx, s.db, user.ID, *frame.MessageID)
+		}
+		if err != nil {
+			return err
+		}
+		s.publishToMembersAll(conv, c.id, &PingPong{Type: frame.Type, Msg: msg})
+	default:
+		return httperr.NewBadRequest("invalid_frame_type", "Unsupported frame type.")
 	}
+	return nil
+}
+
+// publishMessage sends the given message to all the members of the conv, and
+// to the other chat connections of the sender. The connection with the ID
+// origin, from which the message was sent, is skipped.
+func (s *Server) publishMessage(conv *core.Convs, msg *core.Message, origin string) {
+	s.publishToMembersAll(conv, origin, &PingPong{
+		Type: pingPongNewMsg,
+		Msg:  msg,
+	})
 }
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// /api/users/{username}/feeds [GET, POST]
+func (s *Server) handleCustomFeeds(w *responseWriter, r *request) error {
+	user, err := core.GetUserByUsername(r.ctx, s.db, strings.ToLower(r.muxVar("username")), r.viewer)
+	if err != nil {
+		return err
+	}
+	userIsViewer := r.loggedIn && user.ID == *r.viewer
+
+	if r.req.Method == "POST" {
+		// Create a new custom feed.
+		if !r.loggedIn {
+			return errNotLoggedIn
+		}
+		if !userIsViewer {
+			return httperr.NewForbidden("not-your-feed", "Not your feed.")
+		}
+
+		form := struct {
+			Name        string          `json:"name"`
+			DisplayName string          `json:"displayName"` // Optional field, defaults to Name.
+			Description msql.NullString `json:"description"`
+			Public      bool            `json:"public"` // Optional field, defaults to false.
+			Communities []uid.ID        `json:"communities"`
+		}{}
+		if err := r.unmarshalJSONBody(&form); err != nil {
+			return err
+		}
+
+		if form.Name == "" {
+			return httperr.NewBadRequest("custom-feed-name-empty", "Feed name cannot be empty.")
+		}
+		if form.DisplayName == "" {
+			form.DisplayName = form.Name
+		}
+
+		if err := s.rateLimit(r, "cfeed_c_1_"+r.viewer.String(), time.Second*2, 1); err != nil {
+			return err
+		}
+		if err := s.rateLimit(r, "cfeed_c_2_"+r.viewer.String(), time.Hour*24, 50); err != nil {
+			return err
+		}
+
+		feed, err := core.CreateCustomFeed(r.ctx, s.db, *r.viewer, form.Name, form.DisplayName, form.Description, form.Public, form.Communities)
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(feed)
+	}
+
+	// Only show the public feeds of others.
+	feeds, err := core.GetUsersCustomFeeds(r.ctx, s.db, user.ID, !userIsViewer)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(feeds)
+}
+
+// checkCustomFeedAccess returns an error if the viewer cannot access feed. Only
+// the owner of a feed can modify it, and only the owner can view it if it's
+// private.
+func checkCustomFeedAccess(r *request, feed *core.CustomFeed) error {
+	owner := r.loggedIn && *r.viewer == feed.UserID
+	if owner {
+		return nil
+	}
+	if !feed.Public {
+		return httperr.NewNotFound("custom-feed-not-found", "Custom feed not found.")
+	}
+	if r.req.Method != "GET" {
+		if !r.loggedIn {
+			return errNotLoggedIn
+		}
+		return httperr.NewForbidden("not-feed-owner", "Not feed owner.")
+	}
+	return nil
+}
+
+// /api/users/{username}/feeds/{feedname} [GET, PUT, DELETE]
+// /api/feeds/{feedId} [GET, PUT, DELETE]
+func (s *Server) handleCustomFeed(w *responseWriter, r *request, feed *core.CustomFeed) error {
+	if err := checkCustomFeedAccess(r, feed); err != nil {
+		return err
+	}
+
+	if r.req.Method != "GET" {
+		if err := s.rateLimit(r, "cfeed_e_1_"+r.viewer.String(), time.Second, 1); err != nil {
+			return err
+		}
+	}
+
+	switch r.req.Method {
+	case "PUT":
+		data, err := io.ReadAll(r.req.Body)
+		if err != nil {
+			return err
+		}
+		if err := feed.UnmarshalUpdatableFieldsJSON(data); err != nil {
+			return httperr.NewBadRequest("", "Bad JSON body.")
+		}
+		if err := feed.Update(r.ctx, s.db); err != nil {
+			return err
+		}
+	case "DELETE":
+		if err := feed.Delete(r.ctx, s.db); err != nil {
+			return err
+		}
+	}
+
+	return w.writeJSON(feed)
+}
+
+// /api/feeds/{feedId}/communities [GET, POST]
+//
+// The body of a POST request is of the form {"communityId": "..."}.
+func (s *Server) handleCustomFeedCommunities(w *responseWriter, r *request, feed *core.CustomFeed) error {
+	if err := checkCustomFeedAccess(r, feed); err != nil {
+		return err
+	}
+
+	if r.req.Method == "POST" {
+		if err := s.rateLimit(r, "cfeed_comm_1_"+r.viewer.String(), time.Second, 2); err != nil {
+			return err
+		}
+		if err := s.rateLimit(r, "cfeed_comm_2_"+r.viewer.String(), time.Hour, 500); err != nil {
+			return err
+		}
+
+		form := struct {
+			CommunityID uid.ID `json:"communityId"`
+		}{}
+		if err := r.unmarshalJSONBody(&form); err != nil {
+			return err
+		}
+		if err := feed.AddCommunity(r.ctx, s.db, form.CommunityID); err != nil {
+			return err
+		}
+		s.invalidateCustomFeedCache(feed.ID)
+	}
+
+	comms, err := feed.Communities(r.ctx, s.db, r.viewer)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(comms)
+}
+
+// /api/feeds/{feedId}/communities/{communityId} [DELETE]
+func (s *Server) deleteCustomFeedCommunity(w *responseWriter, r *request, feed *core.CustomFeed) error {
+	if err := checkCustomFeedAccess(r, feed); err != nil {
+		return err
+	}
+
+	communityID, err := strToID(r.muxVar("communityId"))
+	if err != nil {
+		return err
+	}
+	if err := feed.RemoveCommunity(r.ctx, s.db, communityID); err != nil {
+		return err
+	}
+	s.invalidateCustomFeedCache(feed.ID)
+
+	comms, err := feed.Communities(r.ctx, s.db, r.viewer)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(comms)
+}
+
+func (s *Server) withCustomFeedByName(f func(*responseWriter, *request, *core.CustomFeed) error) handler {
+	return handler(func(w *responseWriter, r *request) error {
+		user, err := core.GetUserByUsername(r.ctx, s.db, r.muxVar("username"), nil)
+		if err != nil {
+			return err
+		}
+
+		feed, err := core.GetCustomFeedByName(r.ctx, s.db, user.ID, r.muxVar("feedname"))
+		if err != nil {
+			return err
+		}
+
+		return f(w, r, feed)
+	})
+}
+
+func (s *Server) withCustomFeedByID(f func(*responseWriter, *request, *core.CustomFeed) error) handler {
+	return handler(func(w *responseWriter, r *request) error {
+		feedID, err := strconv.Atoi(r.muxVar("feedId"))
+		if err != nil {
+			return httperr.NewBadRequest("invalid-custom-feed-id", "Invalid custom feed id.")
+		}
+
+		feed, err := core.GetCustomFeed(r.ctx, s.db, feedID)
+		if err != nil {
+			return err
+		}
+
+		return f(w, r, feed)
+	})
+}
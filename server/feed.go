@@ -1,9 +1,11 @@
 package server
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/discuitnet/discuit/core"
 	"github.com/discuitnet/discuit/internal/httperr"
@@ -33,6 +35,20 @@ func getFeedLimit(q url.Values, defaultValue, maxValue int) (n int, err error) {
 	return
 }
 
+// parseDateParam parses text, the value of a URL query parameter, as either a
+// date (YYYY-MM-DD) or an RFC3339 timestamp. It returns nil if text is empty.
+func parseDateParam(text string) (*time.Time, error) {
+	if text == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.DateOnly, time.RFC3339} {
+		if t, err := time.Parse(layout, text); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, httperr.NewBadRequest("invalid-date", "Invalid date: "+text+".")
+}
+
 // /api/users/{username}/feed [GET]
 func (s *Server) getUsersFeed(w *responseWriter, r *request) error {
 	user, err := core.GetUserByUsername(r.ctx, s.db, r.muxVar("username"), r.viewer)
@@ -129,18 +145,87 @@ func (s *Server) feed(w *responseWriter, r *request) error {
 		if cid != nil {
 			homeFeed = false
 		}
-		set, err = core.GetFeed(r.ctx, s.db, &core.FeedOptions{
+		var customFeed *int
+		if customFeedText := query.Get("customFeedId"); customFeedText != "" && cid == nil {
+			feedID, err := strconv.Atoi(customFeedText)
+			if err != nil {
+				return httperr.NewBadRequest("invalid-custom-feed-id", "Invalid custom feed id.")
+			}
+			feed, err := core.GetCustomFeed(r.ctx, s.db, feedID)
+			if err != nil {
+				return err
+			}
+			if err := checkCustomFeedAccess(r, feed); err != nil {
+				return err
+			}
+			customFeed = &feed.ID
+			homeFeed = false
+		}
+		opts := &core.FeedOptions{
 			Sort:        sort,
 			DefaultSort: sort == s.config.DefaultFeedSort,
 			Viewer:      r.viewer,
 			Community:   cid,
 			Homefeed:    homeFeed,
+			CustomFeed:  customFeed,
 			Limit:       limit,
 			Next:        nextText,
-		})
+		}
+		if opts.From, err = parseDateParam(query.Get("from")); err != nil {
+			return err
+		}
+		if opts.To, err = parseDateParam(query.Get("to")); err != nil {
+			return err
+		}
+		if flairText := query.Get("flair"); flairText != "" && cid != nil {
+			flair, err := strconv.ParseUint(flairText, 10, 32)
+			if err != nil {
+				return httperr.NewBadRequest("invalid-flair", "Invalid flair id.")
+			}
+			opts.Flair = uint(flair)
+		}
+		if homeFeed && query.Get("hideViewed") == "true" {
+			// Exclude the posts that the viewer has already seen.
+			if !r.loggedIn {
+				return errNotLoggedIn
+			}
+			opts.HideViewed = true
+		}
+		if homeFeed && query.Get("sinceLastVisit") == "true" {
+			// Only posts created since the viewer's previous visit.
+			if !r.loggedIn {
+				return errNotLoggedIn
+			}
+			user, err := core.GetUser(r.ctx, s.db, *r.viewer, nil)
+			if err != nil {
+				return err
+			}
+			if user.LastVisit.Valid {
+				opts.From = &user.LastVisit.Time
+			}
+		}
+		feedType := "all"
+		if homeFeed {
+			feedType = "home"
+		}
+		cached, cacheKey := s.getCachedFeed(feedType, opts)
+		if cached != nil {
+			_, err := w.Write(cached)
+			return err
+		}
+		set, err = core.GetFeed(r.ctx, s.db, opts)
 		if err != nil {
 			return err
 		}
+		if cacheKey != "" {
+			data, err := json.Marshal(set)
+			if err != nil {
+				return err
+			}
+			s.setCachedFeed(cacheKey, data)
+			_, err = w.Write(data)
+			return err
+		}
 	} else {
 		// Modtools feeds.
 		if !r.loggedIn {
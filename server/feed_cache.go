@@ -0,0 +1,165 @@
+package server
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/gomodule/redigo/redis"
+)
+
+// The feeds of logged out users are the same for everyone, and so they're
+// cached in Redis for config.FeedCacheTTL seconds.
+//
+// Instead of deleting cached pages on invalidation, the version of the feeds
+// of a community (and of the site-wide feeds, and of a custom feed) is
+// incremented. The version is
+// part of the cache key, so the old pages are never read again and they expire
+// on their own.
+const (
+	feedCacheVersionAllKey = "feedcache:version:all"
+	feedCacheHitsKey       = "feedcache:hits"
+	feedCacheMissesKey     = "feedcache:misses"
+)
+
+func feedCacheVersionCommunityKey(community uid.ID) string {
+	return "feedcache:version:c:" + community.String()
+}
+
+func feedCacheVersionCustomFeedKey(feed int) string {
+	return "feedcache:version:f:" + strconv.Itoa(feed)
+}
+
+// feedCacheKey returns the key of a cached page of an anonymous feed, or an
+// empty string if the feed is not to be cached.
+func (s *Server) feedCacheKey(conn redis.Conn, feedType string, opts *core.FeedOptions) (string, error) {
+	if s.config.FeedCacheTTL <= 0 || opts.Viewer != nil {
+		return "", nil
+	}
+
+	versionKey, community := feedCacheVersionAllKey, "-"
+	if opts.Community != nil {
+		versionKey, community = feedCacheVersionCommunityKey(*opts.Community), opts.Community.String()
+		if opts.Flair != 0 {
+			community += "-" + strconv.FormatUint(uint64(opts.Flair), 10)
+		}
+	} else if opts.CustomFeed != nil {
+		// The posts of a custom feed are covered by the site-wide version, and
+		// its list of communities by the version of the custom feed.
+		feedVersion, err := redis.Int(conn.Do("GET", feedCacheVersionCustomFeedKey(*opts.CustomFeed)))
+		if err != nil && err != redis.ErrNil {
+			return "", err
+		}
+		community = "f" + strconv.Itoa(*opts.CustomFeed) + "-" + strconv.Itoa(feedVersion)
+	}
+	version, err := redis.Int(conn.Do("GET", versionKey))
+	if err != nil && err != redis.ErrNil {
+		return "", err
+	}
+
+	sort, err := opts.Sort.MarshalText()
+	if err != nil {
+		return "", err
+	}
+	dateRange := ""
+	if opts.From != nil {
+		dateRange += strconv.FormatInt(opts.From.Unix(), 10)
+	}
+	dateRange += "-"
+	if opts.To != nil {
+		dateRange += strconv.FormatInt(opts.To.Unix(), 10)
+	}
+	return strings.Join([]string{
+		"feedcache",
+		feedType,
+		community,
+		string(sort),
+		dateRange,
+		strconv.Itoa(opts.Limit),
+		opts.Next,
+		strconv.Itoa(version),
+	}, ":"), nil
+}
+
+// getCachedFeed returns the cached JSON of the anonymous feed page of opts, if
+// there's one. On a cache miss, key is the key to store the page at with
+// setCachedFeed (key is empty if the feed is not to be cached).
+func (s *Server) getCachedFeed(feedType string, opts *core.FeedOptions) (data []byte, key string) {
+	conn := s.redisPool.Get()
+	defer conn.Close()
+
+	key, err := s.feedCacheKey(conn, feedType, opts)
+	if err != nil {
+		log.Printf("Error getting feed cache key: %v\n", err)
+		return nil, ""
+	}
+	if key == "" {
+		return nil, ""
+	}
+
+	data, err = redis.Bytes(conn.Do("GET", key))
+	if err != nil && err != redis.ErrNil {
+		log.Printf("Error getting cached feed: %v\n", err)
+		return nil, ""
+	}
+
+	counter := feedCacheMissesKey
+	if data != nil {
+		counter = feedCacheHitsKey
+	}
+	if _, err := conn.Do("INCR", counter); err != nil {
+		log.Printf("Error incrementing feed cache counter: %v\n", err)
+	}
+	return data, key
+}
+
+// setCachedFeed caches data, which is the JSON of a feed page, at key.
+func (s *Server) setCachedFeed(key string, data []byte) {
+	conn := s.redisPool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("SET", key, data, "EX", s.config.FeedCacheTTL); err != nil {
+		log.Printf("Error caching feed: %v\n", err)
+	}
+}
+
+// invalidateFeedCache invalidates the cached feeds of community and the
+// site-wide cached feeds. It should be called whenever a post of community is
+// created, deleted, pinned, or locked.
+func (s *Server) invalidateFeedCache(community uid.ID) {
+	conn := s.redisPool.Get()
+	defer conn.Close()
+
+	conn.Send("INCR", feedCacheVersionAllKey)
+	conn.Send("INCR", feedCacheVersionCommunityKey(community))
+	if _, err := conn.Do(""); err != nil {
+		log.Printf("Error invalidating feed cache: %v\n", err)
+	}
+}
+
+// invalidateCustomFeedCache invalidates the cached feeds of the custom feed
+// feed. It should be called whenever a community is added to or removed from
+// the custom feed.
+func (s *Server) invalidateCustomFeedCache(feed int) {
+	conn := s.redisPool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("INCR", feedCacheVersionCustomFeedKey(feed)); err != nil {
+		log.Printf("Error invalidating custom feed cache: %v\n", err)
+	}
+}
+
+// feedCacheStats returns the number of cache hits and misses of anonymous
+// feeds.
+func (s *Server) feedCacheStats() (hits, misses int, err error) {
+	conn := s.redisPool.Get()
+	defer conn.Close()
+
+	values, err := redis.Ints(conn.Do("MGET", feedCacheHitsKey, feedCacheMissesKey))
+	if err != nil {
+		return 0, 0, err
+	}
+	return values[0], values[1], nil
+}
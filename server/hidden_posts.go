@@ -0,0 +1,196 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/gomodule/redigo/redis"
+)
+
+// /api/hidden_posts [GET, POST]
+func (s *Server) handleHiddenPosts(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	switch r.req.Method {
+	case "GET":
+		query := r.urlQueryParams()
+		limit, err := getFeedLimit(query, s.config.PaginationLimit, s.config.PaginationLimitMax)
+		if err != nil {
+			return err
+		}
+		set, err := core.GetHiddenPosts(r.ctx, s.db, *r.viewer, limit, query.Get("next"))
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(set)
+	case "POST":
+		request := struct {
+			PostID uid.ID `json:"postId"`
+		}{}
+		if err := r.unmarshalJSONBody(&request); err != nil {
+			return err
+		}
+		if err := core.HidePost(r.ctx, s.db, *r.viewer, request.PostID); err != nil {
+			return err
+		}
+		return w.writeString(`{"success":true}`)
+	}
+	return nil
+}
+
+// /api/hidden_posts/{postID} [DELETE]
+func (s *Server) unhidePost(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	postID, err := strToID(r.muxVar("postID"))
+	if err != nil {
+		return err
+	}
+
+	if err := core.UnhidePost(r.ctx, s.db, *r.viewer, postID); err != nil {
+		return err
+	}
+
+	return w.writeString(`{"success":true}`)
+}
+
+const (
+	postViewsQueueKey  = "postviews:queue"
+	postViewsBatchSize = 500
+	maxPostViewsPerReq = 100
+)
+
+// popPostViewsScript atomically removes, and returns, at most ARGV[1] items
+// from the head of the list KEYS[1].
+var popPostViewsScript = redis.NewScript(1, `
+local items = redis.call('LRANGE', KEYS[1], 0, tonumber(ARGV[1]) - 1)
+if #items > 0 then
+	redis.call('LTRIM', KEYS[1], #items, -1)
+end
+return items`)
+
+// /api/_postViews [POST]
+//
+// Records that the logged in user has seen the posts (in a feed, say). The
+// views are queued in Redis and saved to the database by FlushPostViews.
+func (s *Server) addPostViews(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	if err := s.rateLimit(r, "post_views_1_"+r.viewer.String(), time.Second, 5); err != nil {
+		return err
+	}
+
+	request := struct {
+		PostIDs []uid.ID `json:"postIds"`
+	}{}
+	if err := r.unmarshalJSONBody(&request); err != nil {
+		return err
+	}
+	if len(request.PostIDs) > maxPostViewsPerReq {
+		return httperr.NewBadRequest("too-many-posts", fmt.Sprintf("Cannot add more than %d views at once.", maxPostViewsPerReq))
+	}
+
+	if err := s.queuePostViews(*r.viewer, request.PostIDs...); err != nil {
+		return err
+	}
+	return w.writeString(`{"success":true}`)
+}
+
+// queuePostViews adds the views of user on posts to the Redis queue of post
+// views.
+func (s *Server) queuePostViews(user uid.ID, posts ...uid.ID) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	conn := s.redisPool.Get()
+	defer conn.Close()
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	args := []any{postViewsQueueKey}
+	for _, post := range posts {
+		args = append(args, user.String()+" "+post.String()+" "+now)
+	}
+	_, err := conn.Do("RPUSH", args...)
+	return err
+}
+
+// FlushPostViews saves the post views queued in Redis to the database, in
+// batches, and it returns the number of views saved. Each batch is taken off
+// the queue atomically, so concurrent flushes (from other server instances, for
+// instance) never save the same views. If saving a batch fails, it's put back
+// in the queue to be retried on the next flush.
+func (s *Server) FlushPostViews(ctx context.Context) (int, error) {
+	conn := s.redisPool.Get()
+	defer conn.Close()
+
+	n := 0
+	for {
+		items, err := redis.Strings(popPostViewsScript.Do(conn, postViewsQueueKey, postViewsBatchSize))
+		if err != nil {
+			return n, err
+		}
+		if len(items) == 0 {
+			return n, nil
+		}
+
+		views := make([]core.PostView, 0, len(items))
+		for _, item := range items {
+			view, err := parseQueuedPostView(item)
+			if err != nil {
+				log.Printf("Skipping invalid queued post view (%s): %v\n", item, err)
+				continue
+			}
+			views = append(views, view)
+		}
+		if err := core.SavePostViews(ctx, s.db, views); err != nil {
+			// The order of the queue doesn't matter (SavePostViews keeps the
+			// latest time of each view).
+			args := []any{postViewsQueueKey}
+			for _, item := range items {
+				args = append(args, item)
+			}
+			if _, rerr := conn.Do("RPUSH", args...); rerr != nil {
+				log.Printf("Error requeueing %d post views: %v\n", len(items), rerr)
+			}
+			return n, err
+		}
+		n += len(views)
+
+		if len(items) < postViewsBatchSize {
+			return n, nil
+		}
+	}
+}
+
+func parseQueuedPostView(item string) (view core.PostView, err error) {
+	fields := strings.Fields(item)
+	if len(fields) != 3 {
+		return view, fmt.Errorf("expected 3 fields, found %d", len(fields))
+	}
+	if view.User, err = uid.FromString(fields[0]); err != nil {
+		return
+	}
+	if view.Post, err = uid.FromString(fields[1]); err != nil {
+		return
+	}
+	t, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return
+	}
+	view.ViewedAt = time.Unix(t, 0)
+	return
+}
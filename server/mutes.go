@@ -25,6 +25,10 @@ func (s *Server) handleMutes(w *responseWriter, r *request) error {
 		if err != nil {
 			return err
 		}
+		filterMutes, err := core.GetMutedFilters(r.ctx, s.db, *r.viewer)
+		if err != nil {
+			return err
+		}
 
 		if commMutes == nil {
 			commMutes = []*core.Mute{}
@@ -32,11 +36,15 @@ func (s *Server) handleMutes(w *responseWriter, r *request) error {
 		if userMutes == nil {
 			userMutes = []*core.Mute{}
 		}
+		if filterMutes == nil {
+			filterMutes = []*core.Mute{}
+		}
 
 		response := struct {
 			CommunityMutes []*core.Mute `json:"communityMutes"`
 			UserMutes      []*core.Mute `json:"userMutes"`
-		}{commMutes, userMutes}
+			FilterMutes    []*core.Mute `json:"filterMutes"`
+		}{commMutes, userMutes, filterMutes}
 
 		return json.NewEncoder(w).Encode(response)
 	}
@@ -48,8 +56,9 @@ func (s *Server) handleMutes(w *responseWriter, r *request) error {
 		}
 	case "POST":
 		request := struct {
-			UserID      uid.ID `json:"userId"`
-			CommunityID uid.ID `json:"communityId"`
+			UserID      uid.ID           `json:"userId"`
+			CommunityID uid.ID           `json:"communityId"`
+			Filter      *core.MuteFilter `json:"filter"` // Keyword, regex, or domain filter.
 		}{}
 		if err := r.unmarshalJSONBody(&request); err != nil {
 			return err
@@ -64,6 +73,11 @@ func (s *Server) handleMutes(w *responseWriter, r *request) error {
 				return err
 			}
 		}
+		if request.Filter != nil {
+			if err := core.MuteFilterPosts(r.ctx, s.db, *r.viewer, *request.Filter); err != nil {
+				return err
+			}
+		}
 		if err := writeMutes(w); err != nil {
 			return err
 		}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"io"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -24,14 +25,27 @@ func (s *Server) addPost(w *responseWriter, r *request) error {
 		return err
 	}
 
-	values, err := r.unmarshalJSONBodyToStringsMap(true)
-	if err != nil {
+	var values struct {
+		Type        string `json:"type"`
+		Title       string `json:"title"` // required
+		Body        string `json:"body"`
+		Community   string `json:"community"` // required
+		UserGroup   string `json:"userGroup"`
+		FlairID     uint   `json:"flairId"` // 0 for no flair.
+		ImageID     string `json:"imageId"`
+		URL         string `json:"url"`
+		CrosspostOf string `json:"crosspostOf"`
+		NSFW        bool   `json:"nsfw"`
+		Spoiler     bool   `json:"spoiler"`
+	}
+	if err := r.unmarshalJSONBody(&values); err != nil {
 		return err
 	}
 
+	var err error
 	var postType core.PostType = core.PostTypeText
-	if values["type"] != "" {
-		if err = postType.UnmarshalText([]byte(values["type"])); err != nil {
+	if values.Type = strings.TrimSpace(values.Type); values.Type != "" {
+		if err = postType.UnmarshalText([]byte(values.Type)); err != nil {
 			return err
 		}
 	}
@@ -41,12 +55,12 @@ func (s *Server) addPost(w *responseWriter, r *request) error {
 		return httperr.NewForbidden("no_image_posts", "Image posts are not allowed")
 	}
 
-	title := values["title"] // required
-	body := values["body"]
-	commName := values["community"] // required
+	title := strings.TrimSpace(values.Title)
+	body := strings.TrimSpace(values.Body)
+	commName := strings.TrimSpace(values.Community)
 
 	userGroup := core.UserGroupNormal
-	if text := values["userGroup"]; text != "" {
+	if text := strings.TrimSpace(values.UserGroup); text != "" {
 		if err := userGroup.UnmarshalText([]byte(text)); err != nil {
 			return err
 		}
@@ -60,15 +74,21 @@ func (s *Server) addPost(w *responseWriter, r *request) error {
 	var post *core.Post
 	switch postType {
 	case core.PostTypeText:
-		post, err = core.CreateTextPost(r.ctx, s.db, *r.viewer, comm.ID, title, body)
+		post, err = core.CreateTextPost(r.ctx, s.db, *r.viewer, comm.ID, title, body, values.FlairID)
 	case core.PostTypeImage:
-		imageID, idErr := uid.FromString(values["imageId"])
+		imageID, idErr := uid.FromString(strings.TrimSpace(values.ImageID))
 		if idErr != nil {
 			return httperr.NewBadRequest("invalid_image_id", "Invalid image ID.")
 		}
-		post, err = core.CreateImagePost(r.ctx, s.db, *r.viewer, comm.ID, title, imageID)
+		post, err = core.CreateImagePost(r.ctx, s.db, *r.viewer, comm.ID, title, imageID, values.FlairID)
 	case core.PostTypeLink:
-		post, err = core.CreateLinkPost(r.ctx, s.db, *r.viewer, comm.ID, title, values["url"])
+		post, err = core.CreateLinkPost(r.ctx, s.db, *r.viewer, comm.ID, title, strings.TrimSpace(values.URL), values.FlairID)
+	case core.PostTypeCrosspost:
+		original, idErr := uid.FromString(strings.TrimSpace(values.CrosspostOf))
+		if idErr != nil {
+			return httperr.NewBadRequest("invalid_post_id", "Invalid crosspost original post ID.")
+		}
+		post, err = core.CreateCrosspost(r.ctx, s.db, *r.viewer, comm.ID, title, original, values.FlairID)
 	default:
 		return httperr.NewBadRequest("invalid_post_type", "Invalid post type.")
 	}
@@ -81,6 +101,16 @@ func (s *Server) addPost(w *responseWriter, r *request) error {
 			return err
 		}
 	}
+	if nsfw, spoiler := values.NSFW, values.Spoiler; nsfw || spoiler {
+		if err := post.SetFlags(r.ctx, *r.viewer, nsfw || post.NSFW, spoiler); err != nil {
+			return err
+		}
+	}
+
+	s.invalidateFeedCache(post.CommunityID)
+	if post.Crosspost != nil {
+		s.invalidateFeedCache(post.Crosspost.CommunityID) // For the crosspost count.
+	}
 
 	// +1 your own post.
 	post.Vote(r.ctx, *r.viewer, true)
@@ -95,7 +125,17 @@ func (s *Server) getPost(w *responseWriter, r *request) error {
 		return err
 	}
 
-	if _, err = post.GetComments(r.ctx, r.viewer, nil); err != nil {
+	if r.loggedIn {
+		if err := s.queuePostViews(*r.viewer, post.ID); err != nil {
+			log.Printf("Error queuing post view: %v\n", err)
+		}
+	}
+
+	sort, err := s.commentSort(r, post)
+	if err != nil {
+		return err
+	}
+	if _, err = post.GetComments(r.ctx, r.viewer, sort, nil); err != nil {
 		return err
 	}
 
@@ -107,6 +147,9 @@ func (s *Server) getPost(w *responseWriter, r *request) error {
 		if err = comm.FetchRules(r.ctx); err != nil {
 			return err
 		}
+		if err = comm.FetchFlairs(r.ctx); err != nil {
+			return err
+		}
 		if err = comm.PopulateMods(r.ctx); err != nil {
 			return err
 		}
@@ -176,6 +219,7 @@ func (s *Server) updatePost(w *responseWriter, r *request) error {
 			if err != nil {
 				return err
 			}
+			s.invalidateFeedCache(post.CommunityID)
 		case "changeAsUser":
 			var as core.UserGroup
 			if err = as.UnmarshalText([]byte(query.Get("userGroup"))); err != nil {
@@ -184,11 +228,35 @@ func (s *Server) updatePost(w *responseWriter, r *request) error {
 			if err = post.ChangeUserGroup(r.ctx, *r.viewer, as); err != nil {
 				return err
 			}
+		case "setFlags":
+			flags := struct {
+				NSFW    bool `json:"nsfw"`
+				Spoiler bool `json:"spoiler"`
+			}{post.NSFW, post.Spoiler} // Unchanged if omitted.
+			if err = r.unmarshalJSONBody(&flags); err != nil {
+				return err
+			}
+			if err = post.SetFlags(r.ctx, *r.viewer, flags.NSFW, flags.Spoiler); err != nil {
+				return err
+			}
+			s.invalidateFeedCache(post.CommunityID)
+		case "setFlair":
+			req := struct {
+				FlairID uint `json:"flairId"` // 0 removes the flair.
+			}{}
+			if err = r.unmarshalJSONBody(&req); err != nil {
+				return err
+			}
+			if err = post.SetFlair(r.ctx, *r.viewer, req.FlairID); err != nil {
+				return err
+			}
+			s.invalidateFeedCache(post.CommunityID)
 		case "pin", "unpin":
 			siteWide := strings.ToLower(query.Get("siteWide")) == "true"
 			if err = post.Pin(r.ctx, *r.viewer, siteWide, action == "unpin", false); err != nil {
 				return err
 			}
+			s.invalidateFeedCache(post.CommunityID)
 		default:
 			return httperr.NewBadRequest("invalid_action", "Unsupported action.")
 		}
@@ -229,6 +297,7 @@ func (s *Server) deletePost(w *responseWriter, r *request) error {
 	if err := post.Delete(r.ctx, *r.viewer, as, deleteContent); err != nil {
 		return err
 	}
+	s.invalidateFeedCache(post.CommunityID)
 
 	return w.writeJSON(post)
 }
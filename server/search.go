@@ -0,0 +1,79 @@
+package server
+
+import (
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httputil"
+)
+
+// /api/search [GET]
+//
+// Query params: q, type (comma separated list of post, comment, community,
+// and user), community (name), author (username), from and to (dates in
+// YYYY-MM-DD or RFC3339 format), nsfw (true to include NSFW communities), sort
+// (relevance, new, or top), limit, and next.
+func (s *Server) search(w *responseWriter, r *request) error {
+	bucket := httputil.GetIP(r.req)
+	if r.loggedIn {
+		bucket = r.viewer.String()
+	}
+	if err := s.rateLimit(r, "search_1_"+bucket, time.Second, 2); err != nil {
+		return err
+	}
+	if err := s.rateLimit(r, "search_2_"+bucket, time.Hour, 500); err != nil {
+		return err
+	}
+
+	query := r.urlQueryParams()
+	opts := &core.SearchOptions{
+		Query:       query.Get("q"),
+		Sort:        core.SearchSort(query.Get("sort")),
+		IncludeNSFW: query.Get("nsfw") == "true",
+		Viewer:      r.viewer,
+		Next:        query.Get("next"),
+	}
+	if opts.Next == "null" || opts.Next == "undefined" {
+		opts.Next = ""
+	}
+
+	var err error
+	if opts.Limit, err = getFeedLimit(query, s.config.PaginationLimit, s.config.PaginationLimitMax); err != nil {
+		return err
+	}
+
+	if types := query.Get("type"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			opts.Types = append(opts.Types, core.SearchType(strings.TrimSpace(t)))
+		}
+	}
+
+	if name := query.Get("community"); name != "" {
+		comm, err := core.GetCommunityByName(r.ctx, s.db, name, r.viewer)
+		if err != nil {
+			return err
+		}
+		opts.Community = &comm.ID
+	}
+	if username := query.Get("author"); username != "" {
+		user, err := core.GetUserByUsername(r.ctx, s.db, username, r.viewer)
+		if err != nil {
+			return err
+		}
+		opts.Author = &user.ID
+	}
+
+	if opts.From, err = parseDateParam(query.Get("from")); err != nil {
+		return err
+	}
+	if opts.To, err = parseDateParam(query.Get("to")); err != nil {
+		return err
+	}
+
+	set, err := core.Search(r.ctx, s.db, opts)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(set)
+}
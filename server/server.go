@@ -23,12 +23,14 @@ import (
 	"github.com/discuitnet/discuit/internal/httperr"
 	"github.com/discuitnet/discuit/internal/httputil"
 	"github.com/discuitnet/discuit/internal/images"
+	"github.com/discuitnet/discuit/internal/pubsub"
 	"github.com/discuitnet/discuit/internal/ratelimits"
 	"github.com/discuitnet/discuit/internal/sessions"
 	"github.com/discuitnet/discuit/internal/uid"
 	"github.com/discuitnet/discuit/internal/utils"
 	"github.com/gomodule/redigo/redis"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
 )
@@ -49,6 +51,10 @@ type Server struct {
 	db        *sql.DB
 	redisPool *redis.Pool
 
+	// For realtime features (chat).
+	broker pubsub.Broker
+	chat   chatState
+
 	// for /api routes
 	router *mux.Router
 
@@ -67,6 +73,8 @@ type Server struct {
 	http500LoggerFile *os.File
 
 	webPushVAPIDKeys core.VAPIDKeys
+
+	chatUpgrader *websocket.Upgrader
 }
 
 func New(db *sql.DB, conf *config.Config) (*Server, error) {
@@ -91,6 +99,14 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 		reactPath:    "./ui/dist/",
 		reactIndex:   "index.html",
 	}
+	s.chatUpgrader = s.newChatUpgrader()
+	if conf.PubSubBroker == "memory" {
+		s.broker = pubsub.NewMemoryBroker()
+		s.chat = newMemoryChatState()
+	} else {
+		s.broker = pubsub.NewRedisBroker(s.redisPool)
+		s.chat = &redisChatState{pool: s.redisPool}
+	}
 
 	if keys, err := core.GetApplicationVAPIDKeys(context.Background(), db); err != nil {
 		log.Printf("Error generating vapid keys: %v (you might want to run migrations)\n", err)
@@ -122,11 +138,22 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 	r.Handle("/api/lists/{listId}/items", s.withHandler(s.withListByID(s.handleListItems))).Methods("GET", "POST", "DELETE")
 	r.Handle("/api/lists/{listId}/items/{itemId}", s.withHandler(s.withListByID(s.deleteListItem))).Methods("DELETE")
 
+	r.Handle("/api/users/{username}/feeds", s.withHandler(s.handleCustomFeeds)).Methods("GET", "POST")
+	r.Handle("/api/users/{username}/feeds/{feedname}", s.withHandler(s.withCustomFeedByName(s.handleCustomFeed))).Methods("GET", "PUT", "DELETE")
+	r.Handle("/api/feeds/{feedId}", s.withHandler(s.withCustomFeedByID(s.handleCustomFeed))).Methods("GET", "PUT", "DELETE")
+	r.Handle("/api/feeds/{feedId}/communities", s.withHandler(s.withCustomFeedByID(s.handleCustomFeedCommunities))).Methods("GET", "POST")
+	r.Handle("/api/feeds/{feedId}/communities/{communityId}", s.withHandler(s.withCustomFeedByID(s.deleteCustomFeedCommunity))).Methods("DELETE")
+
 	r.Handle("/api/mutes", s.withHandler(s.handleMutes)).Methods("GET", "POST", "DELETE")
 	r.Handle("/api/mutes/users/{mutedUserID}", s.withHandler(s.deleteUserMute)).Methods("DELETE")
 	r.Handle("/api/mutes/communities/{mutedCommunityID}", s.withHandler(s.deleteCommunityMute)).Methods("DELETE")
 	r.Handle("/api/mutes/{muteID}", s.withHandler(s.deleteMute)).Methods("DELETE")
 
+	r.Handle("/api/hidden_posts", s.withHandler(s.handleHiddenPosts)).Methods("GET", "POST")
+	r.Handle("/api/hidden_posts/{postID}", s.withHandler(s.unhidePost)).Methods("DELETE")
+	r.Handle("/api/_postViews", s.withHandler(s.addPostViews)).Methods("POST")
+
+	r.Handle("/api/search", s.withHandler(s.search)).Methods("GET")
 	r.Handle("/api/posts", s.withHandler(s.feed)).Methods("GET")
 	r.Handle("/api/posts", s.withHandler(s.addPost)).Methods("POST")
 	r.Handle("/api/posts/{postID}", s.withHandler(s.getPost)).Methods("GET")
@@ -153,6 +180,10 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 	r.Handle("/api/communities/{communityID}/rules/{ruleID}", s.withHandler(s.getCommunityRule)).Methods("GET")
 	r.Handle("/api/communities/{communityID}/rules/{ruleID}", s.withHandler(s.updateCommunityRule)).Methods("PUT")
 	r.Handle("/api/communities/{communityID}/rules/{ruleID}", s.withHandler(s.deleteCommunityRule)).Methods("DELETE")
+	r.Handle("/api/communities/{communityID}/flairs", s.withHandler(s.getCommunityFlairs)).Methods("GET")
+	r.Handle("/api/communities/{communityID}/flairs", s.withHandler(s.addCommunityFlair)).Methods("POST")
+	r.Handle("/api/communities/{communityID}/flairs/{flairID}", s.withHandler(s.updateCommunityFlair)).Methods("PUT")
+	r.Handle("/api/communities/{communityID}/flairs/{flairID}", s.withHandler(s.deleteCommunityFlair)).Methods("DELETE")
 
 	r.Handle("/api/communities/{communityID}/mods", s.withHandler(s.getCommunityMods)).Methods("GET")
 	r.Handle("/api/communities/{communityID}/mods", s.withHandler(s.addCommunityMod)).Methods("POST")
@@ -172,8 +203,17 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 	r.Handle("/api/notifications/{notificationID}", s.withHandler(s.deleteNotification)).Methods("DELETE")
 
 	r.Handle("/api/users/{username}/convs", s.withHandler(s.handleConvs)).Methods("GET", "POST")
+	r.Handle("/api/users/{username}/convs/requests", s.withHandler(s.getConvRequests)).Methods("GET")
 	r.Handle("/api/users/{username}/convs/{convId}", s.withHandler(s.handleConvMessages)).Methods("GET")
+	r.Handle("/api/users/{username}/convs/{convId}", s.withHandler(s.updateConv)).Methods("PUT")
+	r.Handle("/api/users/{username}/convs/{convId}", s.withHandler(s.deleteConv)).Methods("DELETE")
+	r.Handle("/api/users/{username}/convs/{convId}/images", s.withHandler(s.uploadConvImage)).Methods("POST")
+	r.Handle("/api/users/{username}/convs/{convId}/messages/{messageId}", s.withHandler(s.handleConvMessage)).Methods("PUT", "DELETE")
+	r.Handle("/api/users/{username}/convs/{convId}/request", s.withHandler(s.handleConvRequest)).Methods("POST")
+	r.Handle("/api/users/{username}/convs/{convId}/participants", s.withHandler(s.handleConvParticipants)).Methods("GET", "POST")
+	r.Handle("/api/users/{username}/convs/{convId}/participants/{userId}", s.withHandler(s.handleConvParticipant)).Methods("PUT", "DELETE")
 	r.Handle("/api/users/{username}/conn", s.withHandler(s.handleChat)).Methods("GET")
+	r.Handle("/api/users/{username}/presence", s.withHandler(s.getUserPresence)).Methods("GET")
 
 	r.Handle("/api/push_subscriptions", s.withHandler(s.pushSubscriptions)).Methods("POST")
 
@@ -200,6 +240,11 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 		EnableCORS:    true,
 	})
 
+	// RSS and Atom feeds.
+	s.staticRouter.Handle("/all.{format:rss|atom}", s.withSyndicationHandler(s.siteSyndicationFeed)).Methods("GET")
+	s.staticRouter.Handle("/c/{community}.{format:rss|atom}", s.withSyndicationHandler(s.communitySyndicationFeed)).Methods("GET")
+	s.staticRouter.Handle("/u/{username}.{format:rss|atom}", s.withSyndicationHandler(s.userSyndicationFeed)).Methods("GET")
+
 	if conf.UIProxy != "" {
 		s.staticRouter.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ses, err := s.sessions.Get(r)
@@ -276,7 +321,13 @@ func (s *Server) closeLoggers() {
 
 // Close closes the server.
 func (s *Server) Close() error {
+	if _, err := s.FlushPostViews(context.Background()); err != nil {
+		log.Printf("Error flushing post views: %v\n", err)
+	}
 	s.closeLoggers()
+	if err := s.broker.Close(); err != nil {
+		return err
+	}
 	return s.sessions.Close()
 }
 
@@ -812,6 +863,12 @@ func (s *Server) insertMetaTags(doc *html.Node, r *http.Request) {
 				if post.Link != nil && post.Link.Image != nil {
 					image = absoluteURL(*post.Link.Image.URL)
 				}
+			} else if post.Type == core.PostTypeCrosspost && post.Crosspost != nil {
+				if post.Crosspost.Image != nil {
+					image = absoluteURL(*post.Crosspost.Image.URL)
+				} else if post.Crosspost.Link != nil && post.Crosspost.Link.Image != nil {
+					image = absoluteURL(*post.Crosspost.Link.Image.URL)
+				}
 			}
 			if image != "" {
 				appendOGImage(image)
@@ -990,13 +1047,7 @@ func (s *Server) rateLimit(r *request, bucketID string, interval time.Duration,
 		}
 	}
 
-	conn, err := s.redisPool.Dial()
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-
-	if ok, err := ratelimits.Limit(conn, bucketID, interval, maxTokens); err != nil {
+	if ok, err := s.takeToken(bucketID, interval, maxTokens); err != nil {
 		return err
 	} else if !ok {
 		return &httperr.Error{
@@ -1008,6 +1059,17 @@ func (s *Server) rateLimit(r *request, bucketID string, interval time.Duration,
 	return nil
 }
 
+// takeToken takes a token from the rate limiting bucket bucketID (see
+// ratelimits.Limit). It returns false if the bucket is empty.
+func (s *Server) takeToken(bucketID string, interval time.Duration, maxTokens int) (bool, error) {
+	conn, err := s.redisPool.Dial()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	return ratelimits.Limit(conn, bucketID, interval, maxTokens)
+}
+
 func (s *Server) rateLimitUpdateContent(r *request, userID uid.ID) error {
 	if err := s.rateLimit(r, "update_stuff_1_"+userID.String(), time.Second*1, 1); err != nil {
 		return err
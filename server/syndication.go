@@ -0,0 +1,400 @@
+package server
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+)
+
+// syndicationFeed is an RSS or Atom feed, independent of its output format.
+type syndicationFeed struct {
+	Title       string
+	Description string
+	Link        string // The URL of the HTML page that the feed is of.
+	SelfLink    string // The URL of the feed itself.
+	Updated     time.Time
+	Entries     []*syndicationEntry
+}
+
+type syndicationEntry struct {
+	ID        string
+	Title     string
+	Link      string // The URL of the item's HTML page.
+	Related   string // The URL the item links to (for link posts).
+	Author    string
+	Category  string // The community of the item.
+	Content   string
+	Published time.Time
+	Updated   time.Time
+	Enclosure *syndicationEnclosure
+}
+
+type syndicationEnclosure struct {
+	URL    string
+	Type   string
+	Length int
+}
+
+// syndicationHandler is a handler that returns a feed to be written as RSS or
+// Atom, depending on the {format} URL variable.
+type syndicationHandler func(r *request) (*syndicationFeed, error)
+
+func (s *Server) withSyndicationHandler(h syndicationHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Feed readers don't keep cookies, so a session is not created (and so
+		// the feeds are always of a logged out user).
+		req := &request{req: r, ctx: r.Context()}
+		feed, err := h(req)
+		if err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+
+		var v any
+		contentType := "application/rss+xml; charset=UTF-8"
+		if req.muxVar("format") == "atom" {
+			v = feed.atom()
+			contentType = "application/atom+xml; charset=UTF-8"
+		} else {
+			v = feed.rss()
+		}
+
+		out, err := xml.MarshalIndent(v, "", "  ")
+		if err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.Write([]byte(xml.Header))
+		w.Write(out)
+	})
+}
+
+// absoluteURL returns the absolute URL of path on the host of r. If path is
+// already an absolute URL, it's returned as is.
+func absoluteURL(r *request, path string) string {
+	if strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://") {
+		return path
+	}
+	return "https://" + r.req.Host + path
+}
+
+// syndicationFeedSort returns the sort in the URL query parameter sort of r.
+// Unlike the API feeds, the default is the latest posts.
+func syndicationFeedSort(r *request) (core.FeedSort, error) {
+	sort := core.FeedSortLatest
+	if text := r.urlQueryParamsValue("sort"); text != "" {
+		if err := sort.UnmarshalText([]byte(text)); err != nil {
+			return sort, core.ErrInvalidFeedSort
+		}
+	}
+	return sort, nil
+}
+
+// postsSyndicationFeed returns a feed of the posts of the community, or of the
+// whole site if community is nil.
+func (s *Server) postsSyndicationFeed(r *request, community *core.Community) (*syndicationFeed, error) {
+	sort, err := syndicationFeedSort(r)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := getFeedLimit(r.urlQueryParams(), s.config.PaginationLimitMax, s.config.PaginationLimitMax)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &core.FeedOptions{Sort: sort, Limit: limit}
+	feed := &syndicationFeed{
+		Title:       s.config.SiteName,
+		Description: s.config.SiteDescription,
+		Link:        absoluteURL(r, "/"),
+	}
+	if community != nil {
+		opts.Community = &community.ID
+		feed.Title = community.Name + " - " + s.config.SiteName
+		feed.Description = community.About.String
+		feed.Link = absoluteURL(r, "/"+community.Name)
+	}
+	feed.SelfLink = absoluteURL(r, r.req.URL.RequestURI())
+
+	set, err := core.GetFeed(r.ctx, s.db, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, post := range set.Posts {
+		feed.addEntry(postSyndicationEntry(r, post))
+	}
+	return feed, nil
+}
+
+// /all.{format} [GET]
+func (s *Server) siteSyndicationFeed(r *request) (*syndicationFeed, error) {
+	return s.postsSyndicationFeed(r, nil)
+}
+
+// /c/{community}.{format} [GET]
+func (s *Server) communitySyndicationFeed(r *request) (*syndicationFeed, error) {
+	community, err := core.GetCommunityByName(r.ctx, s.db, r.muxVar("community"), nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.postsSyndicationFeed(r, community)
+}
+
+// /u/{username}.{format} [GET]
+//
+// The URL query parameter filter, if present, is either posts or comments.
+func (s *Server) userSyndicationFeed(r *request) (*syndicationFeed, error) {
+	user, err := core.GetUserByUsername(r.ctx, s.db, r.muxVar("username"), nil)
+	if err != nil {
+		return nil, err
+	}
+	if user.Banned || user.Deleted {
+		return nil, httperr.NewNotFound("user_not_found", "User not found.")
+	}
+
+	limit, err := getFeedLimit(r.urlQueryParams(), s.config.PaginationLimitMax, s.config.PaginationLimitMax)
+	if err != nil {
+		return nil, err
+	}
+	set, err := core.GetUserFeed(r.ctx, s.db, nil, user.ID, r.urlQueryParamsValue("filter"), limit, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &syndicationFeed{
+		Title:       "@" + user.Username + " - " + s.config.SiteName,
+		Description: user.About.String,
+		Link:        absoluteURL(r, "/@"+user.Username),
+		SelfLink:    absoluteURL(r, r.req.URL.RequestURI()),
+	}
+	for _, item := range set.Items {
+		switch v := item.Item.(type) {
+		case *core.Post:
+			feed.addEntry(postSyndicationEntry(r, v))
+		case *core.Comment:
+			feed.addEntry(commentSyndicationEntry(r, v))
+		}
+	}
+	return feed, nil
+}
+
+func (f *syndicationFeed) addEntry(e *syndicationEntry) {
+	if e.Updated.After(f.Updated) {
+		f.Updated = e.Updated
+	}
+	f.Entries = append(f.Entries, e)
+}
+
+func postSyndicationEntry(r *request, post *core.Post) *syndicationEntry {
+	e := &syndicationEntry{
+		Title:     post.Title,
+		Link:      absoluteURL(r, "/"+post.CommunityName+"/post/"+post.PublicID),
+		Author:    post.AuthorUsername,
+		Category:  post.CommunityName,
+		Content:   post.Body.String,
+		Published: post.CreatedAt,
+		Updated:   post.CreatedAt,
+	}
+	e.ID = e.Link
+	if post.EditedAt.Valid {
+		e.Updated = post.EditedAt.Time
+	}
+
+	image := post.Image
+	if post.Link != nil {
+		e.Related = post.Link.URL
+		if e.Content == "" {
+			e.Content = post.Link.URL
+		}
+		image = post.Link.Image
+	}
+	if image != nil && image.URL != nil {
+		e.Enclosure = &syndicationEnclosure{URL: absoluteURL(r, *image.URL), Type: "image/jpeg"}
+		if image.MimeType != nil && *image.MimeType != "" {
+			e.Enclosure.Type = *image.MimeType
+		}
+		if image.Size != nil {
+			e.Enclosure.Length = *image.Size
+		}
+	}
+	return e
+}
+
+func commentSyndicationEntry(r *request, comment *core.Comment) *syndicationEntry {
+	e := &syndicationEntry{
+		Title:     "Comment on: " + comment.PostTitle,
+		Link:      absoluteURL(r, "/"+comment.CommunityName+"/post/"+comment.PostPublicID+"/"+comment.ID.String()),
+		Author:    comment.AuthorUsername,
+		Category:  comment.CommunityName,
+		Content:   comment.Body,
+		Published: comment.CreatedAt,
+		Updated:   comment.CreatedAt,
+	}
+	e.ID = e.Link
+	if comment.EditedAt.Valid {
+		e.Updated = comment.EditedAt.Time
+	}
+	return e
+}
+
+// RSS 2.0 output.
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	Description   string     `xml:"description"`
+	LastBuildDate string     `xml:"lastBuildDate,omitempty"`
+	SelfLink      atomLink   `xml:"atom:link"`
+	Items         []*rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        rssGUID       `xml:"guid"`
+	Creator     string        `xml:"dc:creator"`
+	Category    string        `xml:"category"`
+	Description string        `xml:"description"`
+	PubDate     string        `xml:"pubDate"`
+	Updated     string        `xml:"atom:updated"`
+	Enclosure   *rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int    `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+func (f *syndicationFeed) rss() *rssFeed {
+	out := &rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:       f.Title,
+			Link:        f.Link,
+			Description: f.Description,
+			SelfLink:    atomLink{Href: f.SelfLink, Rel: "self", Type: "application/rss+xml"},
+			Items:       make([]*rssItem, len(f.Entries)),
+		},
+	}
+	if !f.Updated.IsZero() {
+		out.Channel.LastBuildDate = f.Updated.UTC().Format(time.RFC1123Z)
+	}
+	for i, e := range f.Entries {
+		item := &rssItem{
+			Title:       e.Title,
+			Link:        e.Link,
+			GUID:        rssGUID{IsPermaLink: true, Value: e.ID},
+			Creator:     e.Author,
+			Category:    e.Category,
+			Description: e.Content,
+			PubDate:     e.Published.UTC().Format(time.RFC1123Z),
+			Updated:     e.Updated.UTC().Format(time.RFC3339),
+		}
+		if e.Enclosure != nil {
+			item.Enclosure = &rssEnclosure{URL: e.Enclosure.URL, Length: e.Enclosure.Length, Type: e.Enclosure.Type}
+		}
+		out.Channel.Items[i] = item
+	}
+	return out
+}
+
+// Atom output.
+
+type atomFeed struct {
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string       `xml:"title"`
+	ID      string       `xml:"id"`
+	Updated string       `xml:"updated"`
+	Links   []atomLink   `xml:"link"`
+	Entries []*atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int    `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string       `xml:"title"`
+	ID        string       `xml:"id"`
+	Links     []atomLink   `xml:"link"`
+	Published string       `xml:"published"`
+	Updated   string       `xml:"updated"`
+	Author    atomAuthor   `xml:"author"`
+	Category  atomCategory `xml:"category"`
+	Content   atomContent  `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func (f *syndicationFeed) atom() *atomFeed {
+	updated := f.Updated
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	out := &atomFeed{
+		Title:   f.Title,
+		ID:      f.SelfLink,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.SelfLink, Rel: "self", Type: "application/atom+xml"},
+			{Href: f.Link, Rel: "alternate", Type: "text/html"},
+		},
+		Entries: make([]*atomEntry, len(f.Entries)),
+	}
+	for i, e := range f.Entries {
+		entry := &atomEntry{
+			Title:     e.Title,
+			ID:        e.ID,
+			Links:     []atomLink{{Href: e.Link, Rel: "alternate", Type: "text/html"}},
+			Published: e.Published.UTC().Format(time.RFC3339),
+			Updated:   e.Updated.UTC().Format(time.RFC3339),
+			Author:    atomAuthor{Name: e.Author},
+			Category:  atomCategory{Term: e.Category},
+			Content:   atomContent{Type: "text", Value: e.Content},
+		}
+		if e.Related != "" {
+			entry.Links = append(entry.Links, atomLink{Href: e.Related, Rel: "related"})
+		}
+		if e.Enclosure != nil {
+			entry.Links = append(entry.Links, atomLink{Href: e.Enclosure.URL, Rel: "enclosure", Type: e.Enclosure.Type, Length: e.Enclosure.Length})
+		}
+		out.Entries[i] = entry
+	}
+	return out
+}